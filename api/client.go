@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultUserAgent   = "cli-radio/1.0"
+	defaultHTTPTimeout = 15 * time.Second
+)
+
+// Resolver is the part of net.Resolver the client needs to discover mirrors
+type Resolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// Client talks to the radio-browser API. Every dependency is a field so tests can swap
+// in a fake server, resolver or clock.
+type Client struct {
+	// BaseURL pins every request to one server and skips mirror discovery
+	BaseURL    string
+	HTTPClient *http.Client
+	Resolver   Resolver
+	Now        func() time.Time
+	UserAgent  string
+	// Blocked, if set, drops stations the user never wants to be offered again
+	Blocked func(s *Station) bool
+
+	servers *ServerPool
+}
+
+// NewClient builds a client using the real network and clock
+func NewClient(opts ServerOptions) *Client {
+	c := &Client{
+		BaseURL:    opts.Pinned,
+		HTTPClient: &http.Client{Timeout: defaultHTTPTimeout},
+		Resolver:   net.DefaultResolver,
+		Now:        time.Now,
+		UserAgent:  defaultUserAgent,
+	}
+	c.servers = newServerPool(c, opts)
+	return c
+}
+
+// DefaultClient is used by the package level helpers
+var DefaultClient = NewClient(ServerOptions{})
+
+// FetchStation returns a random station from DefaultClient
+func FetchStation(profile *FilterProfile) (*Station, error) {
+	return DefaultClient.FetchStation(profile)
+}
+
+// Get valid servers
+func GetServer() (string, error) {
+	return DefaultClient.servers.Get()
+}
+
+// get sends a GET request with the client's User-Agent
+func (c *Client) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+	return c.HTTPClient.Do(req)
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRadioBrowser is an in-process stand-in for a radio-browser mirror
+type fakeRadioBrowser struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	stations []Station
+	status   int    // overrides the response status when non-zero
+	rawBody  string // sent instead of stations when non-empty
+	queries  []url.Values
+	agents   []string
+}
+
+func newFakeRadioBrowser(t *testing.T, stations ...Station) *fakeRadioBrowser {
+	f := &fakeRadioBrowser{stations: stations}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/json/stations/search", f.handleSearch)
+	mux.HandleFunc("/json/stats", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"OK"}`)
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeRadioBrowser) handleSearch(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, r.URL.Query())
+	f.agents = append(f.agents, r.UserAgent())
+
+	if f.status != 0 {
+		http.Error(w, http.StatusText(f.status), f.status)
+		return
+	}
+	if f.rawBody != "" {
+		fmt.Fprint(w, f.rawBody)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f.stations)
+}
+
+func (f *fakeRadioBrowser) lastQuery() url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.queries) == 0 {
+		return nil
+	}
+	return f.queries[len(f.queries)-1]
+}
+
+func (f *fakeRadioBrowser) requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.queries)
+}
+
+// fakeResolver answers lookups from fixed tables
+type fakeResolver struct {
+	ips   []net.IP
+	names map[string][]string
+	err   error
+}
+
+func (r *fakeResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	return r.ips, r.err
+}
+
+func (r *fakeResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	names, ok := r.names[addr]
+	if !ok {
+		return nil, fmt.Errorf("no PTR for %s", addr)
+	}
+	return names, nil
+}
+
+// fakeClock only moves when told to
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestClient returns a client pinned to the fake server with a fixed clock
+func newTestClient(f *fakeRadioBrowser) (*Client, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	c := NewClient(ServerOptions{})
+	c.BaseURL = f.URL
+	c.HTTPClient = f.Client()
+	c.Resolver = &fakeResolver{err: fmt.Errorf("resolver should not be used")}
+	c.Now = clock.Now
+	c.UserAgent = "cli-radio-test"
+	return c, clock
+}
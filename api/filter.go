@@ -0,0 +1,204 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FilterProfile is a named set of rules deciding which stations FetchStation may return.
+// Include lists match if the station has any of the values; exclude lists reject on any match.
+type FilterProfile struct {
+	Name             string   `json:"name"`
+	Tags             []string `json:"tags,omitempty"`
+	ExcludeTags      []string `json:"exclude_tags,omitempty"`
+	Languages        []string `json:"languages,omitempty"`
+	ExcludeLanguages []string `json:"exclude_languages,omitempty"`
+	Countries        []string `json:"countries,omitempty"` // ISO 3166-1 alpha-2 codes
+	ExcludeCountries []string `json:"exclude_countries,omitempty"`
+	Codecs           []string `json:"codecs,omitempty"`
+	MinBitrate       int      `json:"min_bitrate,omitempty"`
+	MaxBitrate       int      `json:"max_bitrate,omitempty"`
+	HTTPSOnly        bool     `json:"https_only,omitempty"`
+}
+
+// DefaultProfile is used when no config file is present
+var DefaultProfile = FilterProfile{
+	Name:             "default",
+	ExcludeTags:      []string{"news", "news+talk", "military", "sports", "podcast", "podcasts"},
+	ExcludeLanguages: []string{"chinese", "iranian", "mandarin"},
+	MinBitrate:       96,
+}
+
+const (
+	// how many random stations FetchStation asks for so the local filters still have something left
+	fetchBatchSize = 10
+	// the most queries one fetch is split into, include lists past that are left to Matches
+	maxQueries = 8
+)
+
+// Matches reports whether the station satisfies every rule in the profile.
+// The radio-browser API can only filter on a single value per field, so this is the final word.
+func (p *FilterProfile) Matches(s *Station) bool {
+	if len(p.Tags) > 0 && !anyIn(p.Tags, s.Tags) {
+		return false
+	}
+	if anyIn(p.ExcludeTags, s.Tags) {
+		return false
+	}
+	if len(p.Languages) > 0 && !anyIn(p.Languages, s.Languages) {
+		return false
+	}
+	if anyIn(p.ExcludeLanguages, s.Languages) {
+		return false
+	}
+	if len(p.Countries) > 0 && !anyIn(p.Countries, []string{s.CountryCode}) {
+		return false
+	}
+	if anyIn(p.ExcludeCountries, []string{s.CountryCode}) {
+		return false
+	}
+	if len(p.Codecs) > 0 && !anyIn(p.Codecs, []string{s.Codec}) {
+		return false
+	}
+	if p.MinBitrate > 0 && s.Bitrate < p.MinBitrate {
+		return false
+	}
+	if p.MaxBitrate > 0 && s.Bitrate > p.MaxBitrate {
+		return false
+	}
+	if p.HTTPSOnly && !strings.HasPrefix(strings.ToLower(s.StreamURL()), "https://") {
+		return false
+	}
+	return true
+}
+
+// queries splits the include lists into profiles with one value each, since the API only
+// filters on one value per field, so every value gets a query of its own. Lists that would
+// take it past maxQueries are left to Matches.
+func (p *FilterProfile) queries() []FilterProfile {
+	queries := []FilterProfile{*p}
+	split := func(values []string, set func(q *FilterProfile, values []string)) {
+		if len(values) < 2 || len(queries)*len(values) > maxQueries {
+			return
+		}
+		next := make([]FilterProfile, 0, len(queries)*len(values))
+		for _, q := range queries {
+			for _, v := range values {
+				set(&q, []string{v})
+				next = append(next, q)
+			}
+		}
+		queries = next
+	}
+	split(p.Tags, func(q *FilterProfile, v []string) { q.Tags = v })
+	split(p.Languages, func(q *FilterProfile, v []string) { q.Languages = v })
+	split(p.Countries, func(q *FilterProfile, v []string) { q.Countries = v })
+	split(p.Codecs, func(q *FilterProfile, v []string) { q.Codecs = v })
+	return queries
+}
+
+func (p *FilterProfile) String() string {
+	var parts []string
+	add := func(label string, values []string) {
+		if len(values) > 0 {
+			parts = append(parts, label+"="+strings.Join(values, ","))
+		}
+	}
+	add("tags", p.Tags)
+	add("-tags", p.ExcludeTags)
+	add("languages", p.Languages)
+	add("-languages", p.ExcludeLanguages)
+	add("countries", p.Countries)
+	add("-countries", p.ExcludeCountries)
+	add("codecs", p.Codecs)
+	if p.MinBitrate > 0 {
+		parts = append(parts, fmt.Sprintf("bitrate>=%d", p.MinBitrate))
+	}
+	if p.MaxBitrate > 0 {
+		parts = append(parts, fmt.Sprintf("bitrate<=%d", p.MaxBitrate))
+	}
+	if p.HTTPSOnly {
+		parts = append(parts, "https")
+	}
+	if len(parts) == 0 {
+		return p.Name + ": no filters"
+	}
+	return p.Name + ": " + strings.Join(parts, " ")
+}
+
+func buildFilterURL(baseURL string, profile *FilterProfile, limit int, now time.Time) (string, error) {
+	q := url.Values{}
+
+	q.Set("hidebroken", "true")
+	if profile.MinBitrate > 0 {
+		q.Set("bitrateMin", fmt.Sprint(profile.MinBitrate))
+	}
+	if profile.MaxBitrate > 0 {
+		q.Set("bitrateMax", fmt.Sprint(profile.MaxBitrate))
+	}
+	if profile.HTTPSOnly {
+		q.Set("is_https", "true")
+	}
+
+	// the API only takes one value for these, anything more is left to Matches
+	if len(profile.Tags) == 1 {
+		q.Set("tag", profile.Tags[0])
+	}
+	if len(profile.Languages) == 1 {
+		q.Set("language", profile.Languages[0])
+	}
+	if len(profile.Countries) == 1 {
+		q.Set("countrycode", profile.Countries[0])
+	}
+	if len(profile.Codecs) == 1 {
+		q.Set("codec", profile.Codecs[0])
+	}
+
+	// add your negative tags / languages
+	for _, tag := range profile.ExcludeTags {
+		q.Add("tagNot", tag)
+	}
+	for _, lang := range profile.ExcludeLanguages {
+		q.Add("languageNot", lang)
+	}
+
+	q.Set("order", "random")
+	q.Set("limit", fmt.Sprint(limit))
+	q.Set("nocache", fmt.Sprint(now.UnixNano()))
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	u.Path = "/json/stations/search"
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// splitList turns radio-browser's comma separated fields into a cleaned up slice
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// anyIn reports whether any of the wanted values appears in have (case-insensitive)
+func anyIn(wanted, have []string) bool {
+	for _, w := range wanted {
+		for _, h := range have {
+			if strings.EqualFold(w, h) {
+				return true
+			}
+		}
+	}
+	return false
+}
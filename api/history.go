@@ -0,0 +1,79 @@
+package api
+
+import "fmt"
+
+// History is the back/forward navigation between stations, like a browser's.
+// It also remembers every station heard this session for the `history` listing.
+type History struct {
+	back    []*Station
+	current *Station
+	forward []*Station
+	heard   []*Station
+}
+
+// Current returns the station being played, or nil
+func (h *History) Current() *Station {
+	return h.current
+}
+
+// Visit makes s the current station. Going somewhere new throws away the forward stack.
+func (h *History) Visit(s *Station) {
+	if h.current != nil {
+		h.back = append(h.back, h.current)
+	}
+	h.current = s
+	h.forward = nil
+	h.remember(s)
+}
+
+// Back steps to the previous station
+func (h *History) Back() (*Station, bool) {
+	if len(h.back) == 0 {
+		return nil, false
+	}
+	h.forward = append(h.forward, h.current)
+	h.current = h.back[len(h.back)-1]
+	h.back = h.back[:len(h.back)-1]
+	return h.current, true
+}
+
+// Forward undoes a Back
+func (h *History) Forward() (*Station, bool) {
+	if len(h.forward) == 0 {
+		return nil, false
+	}
+	h.back = append(h.back, h.current)
+	h.current = h.forward[len(h.forward)-1]
+	h.forward = h.forward[:len(h.forward)-1]
+	return h.current, true
+}
+
+// CanGoForward reports whether Forward has somewhere to go
+func (h *History) CanGoForward() bool {
+	return len(h.forward) > 0
+}
+
+// Heard lists every station played this session, oldest first, without repeats
+func (h *History) Heard() []*Station {
+	return h.heard
+}
+
+// Goto visits the nth (1-based) station from Heard
+func (h *History) Goto(n int) (*Station, error) {
+	if n < 1 || n > len(h.heard) {
+		return nil, fmt.Errorf("no station %d in history", n)
+	}
+	s := h.heard[n-1]
+	h.Visit(s)
+	return s, nil
+}
+
+func (h *History) remember(s *Station) {
+	key := s.Key()
+	for _, heard := range h.heard {
+		if heard.Key() == key {
+			return
+		}
+	}
+	h.heard = append(h.heard, s)
+}
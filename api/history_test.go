@@ -0,0 +1,50 @@
+package api
+
+import "testing"
+
+func TestHistoryNavigation(t *testing.T) {
+	var h History
+	a, b, c, d := &Station{UUID: "a"}, &Station{UUID: "b"}, &Station{UUID: "c"}, &Station{UUID: "d"}
+
+	if _, ok := h.Back(); ok {
+		t.Fatal("Back on empty history should fail")
+	}
+	h.Visit(a)
+	h.Visit(b)
+	h.Visit(c)
+
+	// go all the way back, further than the old single prevStation allowed
+	for _, want := range []*Station{b, a} {
+		if got, ok := h.Back(); !ok || got != want {
+			t.Fatalf("Back() = %v, want %s", got, want.UUID)
+		}
+	}
+	if _, ok := h.Back(); ok {
+		t.Error("Back past the first station should fail")
+	}
+	if got, ok := h.Forward(); !ok || got != b {
+		t.Errorf("Forward() = %v, want b", got)
+	}
+
+	// visiting somewhere new drops the forward stack
+	h.Visit(d)
+	if h.CanGoForward() {
+		t.Error("Visit should clear the forward stack")
+	}
+	if got, _ := h.Back(); got != b {
+		t.Errorf("Back() after Visit = %v, want b", got)
+	}
+
+	if heard := h.Heard(); len(heard) != 4 || heard[3] != d {
+		t.Errorf("Heard() = %v, want a b c d", heard)
+	}
+	if got, err := h.Goto(3); err != nil || got != c || h.Current() != c {
+		t.Errorf("Goto(3) = %v, %v; want c", got, err)
+	}
+	if len(h.Heard()) != 4 {
+		t.Error("Goto shouldn't add a repeat to Heard")
+	}
+	if _, err := h.Goto(9); err == nil {
+		t.Error("Goto out of range should fail")
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const (
+	queueBatchSize = 20
+	queueLowWater  = 5
+	// how many batches in a row can come back as nothing but repeats before we give up
+	maxEmptyRefills = 3
+)
+
+// StationQueue keeps a buffer of random stations so "next" doesn't have to wait on the network.
+// Refills run in the background once the buffer runs low and stop when the queue is closed.
+type StationQueue struct {
+	client *Client
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	refillMu sync.Mutex // only one refill talks to the API at a time
+
+	mu       sync.Mutex
+	profile  *FilterProfile
+	stations []Station
+	seen     map[string]bool
+}
+
+func NewStationQueue(client *Client, profile *FilterProfile) *StationQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &StationQueue{
+		client:  client,
+		ctx:     ctx,
+		cancel:  cancel,
+		profile: profile,
+		seen:    map[string]bool{},
+	}
+}
+
+// Prefetch starts filling the queue in the background
+func (q *StationQueue) Prefetch() {
+	go q.refill()
+}
+
+// Next pops the next station, only waiting on the network if the queue is empty
+func (q *StationQueue) Next() (*Station, error) {
+	for empty := 0; ; {
+		q.mu.Lock()
+		if len(q.stations) > 0 {
+			station := q.stations[0]
+			q.stations = q.stations[1:]
+			low := len(q.stations) < queueLowWater
+			q.mu.Unlock()
+			if low {
+				go q.refill()
+			}
+			return &station, nil
+		}
+		q.mu.Unlock()
+
+		added, err := q.refill()
+		if err != nil {
+			return nil, err
+		}
+		if added == 0 {
+			empty++
+			if empty >= maxEmptyRefills {
+				return nil, errors.New("no new stations found, try another profile")
+			}
+		}
+	}
+}
+
+// SetProfile drops everything queued for the old profile and starts fetching for the new one.
+// Stations the old profile turned up count as new again.
+func (q *StationQueue) SetProfile(profile *FilterProfile) {
+	q.mu.Lock()
+	q.profile = profile
+	q.stations = nil
+	q.seen = map[string]bool{}
+	q.mu.Unlock()
+	go q.refill()
+}
+
+// Len reports how many stations are ready to go
+func (q *StationQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.stations)
+}
+
+// Close cancels any refill in flight
+func (q *StationQueue) Close() {
+	q.cancel()
+}
+
+// refill fetches a batch if the queue is running low and returns how many new stations it added
+func (q *StationQueue) refill() (int, error) {
+	q.refillMu.Lock()
+	defer q.refillMu.Unlock()
+
+	q.mu.Lock()
+	if len(q.stations) >= queueLowWater {
+		q.mu.Unlock()
+		return 0, nil
+	}
+	profile := q.profile
+	q.mu.Unlock()
+
+	if err := q.ctx.Err(); err != nil {
+		return 0, err
+	}
+	stations, err := q.client.FetchStations(q.ctx, profile, queueBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.profile != profile {
+		// the profile changed while we were fetching, these belong to the old one
+		return 0, nil
+	}
+
+	added := 0
+	for _, s := range stations {
+		key := s.Key()
+		if q.seen[key] {
+			continue
+		}
+		q.seen[key] = true
+		q.stations = append(q.stations, s)
+		added++
+	}
+	return added, nil
+}
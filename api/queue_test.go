@@ -0,0 +1,95 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStationQueueDropsDuplicates(t *testing.T) {
+	fake := newFakeRadioBrowser(t,
+		Station{UUID: "a", Name: "A", Bitrate: 128},
+		Station{UUID: "b", Name: "B", Bitrate: 128},
+		Station{UUID: "a", Name: "A again", Bitrate: 128},
+	)
+	client, _ := newTestClient(fake)
+	queue := NewStationQueue(client, nil)
+	defer queue.Close()
+
+	var names []string
+	for i := 0; i < 2; i++ {
+		station, err := queue.Next()
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		names = append(names, station.Name)
+	}
+	if names[0] != "A" || names[1] != "B" {
+		t.Errorf("Next returned %v, want [A B]", names)
+	}
+
+	// the fake only ever returns the same stations, so the queue has to give up eventually
+	if station, err := queue.Next(); err == nil {
+		t.Errorf("Next returned %q, want an error once everything is a repeat", station.Name)
+	}
+	if got := fake.lastQuery().Get("limit"); got != "20" {
+		t.Errorf("limit = %s, want 20", got)
+	}
+}
+
+func TestStationQueueSetProfile(t *testing.T) {
+	fake := newFakeRadioBrowser(t, Station{UUID: "a", Name: "A", Tags: []string{"jazz"}, Bitrate: 128})
+	client, _ := newTestClient(fake)
+	queue := NewStationQueue(client, nil)
+	defer queue.Close()
+
+	if _, err := queue.Next(); err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	// A was a repeat under the old profile, the new one starts with a clean slate
+	queue.SetProfile(&FilterProfile{Name: "jazz", Tags: []string{"jazz"}})
+	station, err := queue.Next()
+	if err != nil || station.Name != "A" {
+		t.Fatalf("Next after SetProfile = %v, %v; want A again", station, err)
+	}
+	if got := fake.lastQuery().Get("tag"); got != "jazz" {
+		t.Errorf("tag = %q, want the new profile's jazz", got)
+	}
+}
+
+func TestStationQueuePrefetch(t *testing.T) {
+	fake := newFakeRadioBrowser(t,
+		Station{UUID: "a", Name: "A", Bitrate: 128},
+		Station{UUID: "b", Name: "B", Bitrate: 128},
+	)
+	client, _ := newTestClient(fake)
+	queue := NewStationQueue(client, nil)
+	defer queue.Close()
+
+	queue.Prefetch()
+	deadline := time.Now().Add(2 * time.Second)
+	for queue.Len() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("queue never filled in the background")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	station, err := queue.Next()
+	if err != nil || station.Name != "A" {
+		t.Fatalf("Next = %v, %v; want the prefetched station A", station, err)
+	}
+}
+
+func TestStationQueueClosed(t *testing.T) {
+	fake := newFakeRadioBrowser(t, Station{UUID: "a", Name: "A", Bitrate: 128})
+	client, _ := newTestClient(fake)
+	queue := NewStationQueue(client, nil)
+	queue.Close()
+
+	if _, err := queue.Next(); err == nil {
+		t.Error("Next on a closed queue should fail")
+	}
+	if fake.requests() != 0 {
+		t.Errorf("closed queue still made %d requests", fake.requests())
+	}
+}
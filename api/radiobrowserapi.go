@@ -1,68 +1,125 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net"
+	"math/rand"
 	"net/http"
-	"net/url"
-	"strings"
-	"time"
 )
 
-type Station struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
-	Tags string `json:"tags"`
+// serverError marks failures that are the mirror's fault, so the next one is worth a try
+type serverError struct{ err error }
+
+func (e *serverError) Error() string { return e.err.Error() }
+func (e *serverError) Unwrap() error { return e.err }
+
+// FetchStation returns a random station allowed by the given profile (DefaultProfile if nil)
+func (c *Client) FetchStation(profile *FilterProfile) (*Station, error) {
+	if profile == nil {
+		profile = &DefaultProfile
+	}
+	stations, err := c.FetchStations(context.Background(), profile, fetchBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	return &stations[0], nil
 }
 
-var excludedTags = []string{"news", "news+talk", "military", "sports", "podcast", "podcasts"}
-var excludedLanguages = []string{"chinese", "iranian", "mandarin"}
+// FetchStations returns up to limit random stations allowed by the profile
+func (c *Client) FetchStations(ctx context.Context, profile *FilterProfile, limit int) ([]Station, error) {
+	if profile == nil {
+		profile = &DefaultProfile
+	}
+	var stations []Station
+	err := c.tryServers(func(server string) error {
+		var err error
+		stations, err = c.fetchStationsFrom(ctx, server, profile, limit)
+		return err
+	})
+	return stations, err
+}
 
-// Get valid servers
-func GetServer() (string, error) {
-	// Perform DNS lookup
-	ips, err := net.LookupIP("all.api.radio-browser.info")
+// tryServers runs fn against each mirror in turn, moving on only when the mirror itself is at fault
+func (c *Client) tryServers(fn func(server string) error) error {
+	candidates, err := c.servers.Candidates()
 	if err != nil {
-		return "", fmt.Errorf("DNS lookup failed: %w", err)
+		return fmt.Errorf("failed to get server: %w", err)
 	}
 
-	// Reverse DNS to get hostnames
-	for _, ip := range ips {
-		names, err := net.LookupAddr(ip.String())
-		if err == nil && len(names) > 0 {
-			name := strings.TrimSuffix(names[0], ".")
-			return "https://" + name, nil
+	var lastErr error
+	for _, server := range candidates {
+		err := fn(server)
+		var srvErr *serverError
+		if errors.As(err, &srvErr) {
+			c.servers.MarkFailed(server)
+			lastErr = err
+			continue
 		}
+		c.servers.MarkOK(server)
+		return err
 	}
-	return "", fmt.Errorf("no valid servers")
+	return lastErr
 }
 
-func FetchStation() (*Station, error) {
-	server, err := GetServer()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get server: %w", err)
+// fetchStationsFrom runs one query per include value and mixes the results together
+func (c *Client) fetchStationsFrom(ctx context.Context, server string, profile *FilterProfile, limit int) ([]Station, error) {
+	var matching []Station
+	seen := map[string]bool{}
+	queries := profile.queries()
+	for _, query := range queries {
+		stations, err := c.fetchQuery(ctx, server, &query, limit)
+		if err != nil {
+			return nil, err
+		}
+		for i := range stations {
+			key := stations[i].Key()
+			if seen[key] || !profile.Matches(&stations[i]) || c.isBlocked(&stations[i]) {
+				continue
+			}
+			seen[key] = true
+			matching = append(matching, stations[i])
+		}
 	}
-	url, err := buildFilterURL(server)
+	if len(matching) == 0 {
+		return nil, fmt.Errorf("no stations found for profile %q", profile.Name)
+	}
+	if len(queries) > 1 {
+		// each query comes back in random order, but one after the other
+		rand.Shuffle(len(matching), func(i, j int) { matching[i], matching[j] = matching[j], matching[i] })
+	}
+	return matching, nil
+}
+
+func (c *Client) fetchQuery(ctx context.Context, server string, profile *FilterProfile, limit int) ([]Station, error) {
+	url, err := buildFilterURL(server, profile, limit, c.Now())
 	if err != nil {
 		return nil, fmt.Errorf("error building API url: %w", err)
 	}
-	resp, err := http.Get(url)
+	resp, err := c.get(ctx, url)
 	if err != nil {
-		return nil, fmt.Errorf("API request failed: %w", err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &serverError{fmt.Errorf("API request failed: %w", err)}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		err := fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		if resp.StatusCode >= 500 {
+			return nil, &serverError{err}
+		}
+		return nil, err
 	}
 
 	// Read the response body
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, &serverError{fmt.Errorf("failed to read response body: %w", err)}
 	}
 
 	var stations []Station
@@ -70,39 +127,9 @@ func FetchStation() (*Station, error) {
 	if err := json.Unmarshal(bodyBytes, &stations); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
-
-	if len(stations) == 0 {
-		return nil, fmt.Errorf("no stations found")
-	}
-	return &stations[0], nil
+	return stations, nil
 }
 
-func buildFilterURL(baseURL string) (string, error) {
-	q := url.Values{}
-
-	// q.Set("codec", "opus,aac,ogg")
-	q.Set("bitrateMin", "96")
-	q.Set("hidebroken", "true")
-
-	// add your negative tags / languages
-	for _, tag := range excludedTags {
-		q.Add("tagNot", tag)
-	}
-	for _, lang := range excludedLanguages {
-		q.Add("languageNot", lang)
-	}
-
-	q.Set("order", "random")
-	q.Set("limit", "1")
-	q.Set("nocache", fmt.Sprint(time.Now().UnixNano()))
-
-	u, err := url.Parse(baseURL)
-	if err != nil {
-		return "", err
-	}
-
-	u.Path = "/json/stations/search"
-	u.RawQuery = q.Encode()
-
-	return u.String(), nil
+func (c *Client) isBlocked(s *Station) bool {
+	return c.Blocked != nil && c.Blocked(s)
 }
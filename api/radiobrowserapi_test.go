@@ -1,10 +1,27 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
+// the live tests hit the real radio-browser network, so they only run when asked for
+func skipUnlessLive(t *testing.T) {
+	if os.Getenv("RADIO_LIVE_TESTS") == "" {
+		t.Skip("set RADIO_LIVE_TESTS=1 to run against the real radio-browser API")
+	}
+}
+
 func TestGetServer(t *testing.T) {
+	skipUnlessLive(t)
 	server, err := GetServer()
 	if err != nil {
 		t.Fatalf("GetServer failed: %v", err)
@@ -14,10 +31,373 @@ func TestGetServer(t *testing.T) {
 }
 
 func TestFetchStation(t *testing.T) {
-	station, err := FetchStation()
+	skipUnlessLive(t)
+	station, err := FetchStation(nil)
 	if err != nil {
 		t.Fatalf("FetchStation failed: %v", err)
 	}
 
-	t.Logf("Fetched Station: Name=%s, URL=%s, Tags=%s", station.Name, station.URL, station.Tags)
+	t.Logf("Fetched Station: Name=%s, URL=%s, Tags=%v", station.Name, station.URL, station.Tags)
+}
+
+func TestClientFetchStation(t *testing.T) {
+	fake := newFakeRadioBrowser(t,
+		Station{Name: "Talk FM", URL: "https://talk.example/stream", Tags: []string{"news"}, Bitrate: 128},
+		Station{Name: "Groove", URL: "https://groove.example/stream", Tags: []string{"funk", "soul"}, Bitrate: 128},
+	)
+	client, clock := newTestClient(fake)
+
+	station, err := client.FetchStation(nil)
+	if err != nil {
+		t.Fatalf("FetchStation failed: %v", err)
+	}
+	if station.Name != "Groove" {
+		t.Errorf("FetchStation returned %q, want the station that isn't excluded", station.Name)
+	}
+
+	q := fake.lastQuery()
+	if got := q["tagNot"]; len(got) != len(DefaultProfile.ExcludeTags) {
+		t.Errorf("tagNot = %v, want %v", got, DefaultProfile.ExcludeTags)
+	}
+	if q.Get("bitrateMin") != "96" || q.Get("order") != "random" || q.Get("hidebroken") != "true" {
+		t.Errorf("unexpected query %v", q)
+	}
+	if q.Get("nocache") != fmt.Sprint(clock.Now().UnixNano()) {
+		t.Errorf("nocache = %s, want the injected clock", q.Get("nocache"))
+	}
+	if fake.agents[0] != "cli-radio-test" {
+		t.Errorf("User-Agent = %q", fake.agents[0])
+	}
+}
+
+func TestClientFetchStationProfileQuery(t *testing.T) {
+	fake := newFakeRadioBrowser(t,
+		Station{Name: "Jazz Tokyo", URL: "https://jazz.example/stream", Tags: []string{"jazz"}, CountryCode: "JP", Codec: "AAC", Bitrate: 192},
+	)
+	client, _ := newTestClient(fake)
+
+	profile := &FilterProfile{Name: "jazz", Tags: []string{"jazz"}, Countries: []string{"JP"}, Codecs: []string{"AAC", "MP3"}, MaxBitrate: 256, HTTPSOnly: true}
+	if _, err := client.FetchStation(profile); err != nil {
+		t.Fatalf("FetchStation failed: %v", err)
+	}
+
+	q := fake.lastQuery()
+	want := map[string]string{"tag": "jazz", "countrycode": "JP", "bitrateMax": "256", "is_https": "true", "codec": "MP3"}
+	for key, value := range want {
+		if q.Get(key) != value {
+			t.Errorf("%s = %q, want %q", key, q.Get(key), value)
+		}
+	}
+}
+
+func TestClientFetchStationQueriesEachIncludeValue(t *testing.T) {
+	fake := newFakeRadioBrowser(t,
+		Station{Name: "Jazz FM", URL: "https://jazz.example/stream", Tags: []string{"jazz"}, Bitrate: 128},
+		Station{Name: "Bop City", URL: "https://bop.example/stream", Tags: []string{"bebop"}, Bitrate: 128},
+	)
+	client, _ := newTestClient(fake)
+
+	profile := &FilterProfile{Name: "bop", Tags: []string{"jazz", "bebop"}}
+	stations, err := client.FetchStations(context.Background(), profile, fetchBatchSize)
+	if err != nil {
+		t.Fatalf("FetchStations failed: %v", err)
+	}
+	// the fake ignores the query, so both queries get both stations back
+	if len(stations) != 2 {
+		t.Errorf("got %d stations, want the two queries merged into 2", len(stations))
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	var tags []string
+	for _, q := range fake.queries {
+		tags = append(tags, q.Get("tag"))
+	}
+	if strings.Join(tags, ",") != "jazz,bebop" {
+		t.Errorf("queried tags %v, want one query each for jazz and bebop", tags)
+	}
+}
+
+func TestProfileQueries(t *testing.T) {
+	tests := []struct {
+		profile FilterProfile
+		want    int
+	}{
+		{FilterProfile{}, 1},
+		{FilterProfile{Tags: []string{"jazz"}}, 1},
+		{FilterProfile{Tags: []string{"jazz", "bebop"}, Codecs: []string{"AAC", "MP3"}}, 4},
+		// 3 tags times 3 countries is too many, the countries are left to Matches
+		{FilterProfile{Tags: []string{"a", "b", "c"}, Countries: []string{"JP", "US", "FR"}}, 3},
+	}
+	for _, tt := range tests {
+		if got := tt.profile.queries(); len(got) != tt.want {
+			t.Errorf("queries(%s) = %d, want %d", tt.profile.String(), len(got), tt.want)
+		}
+	}
+}
+
+func TestClientFetchStationErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		stations []Station
+		wantErr  string
+	}{
+		{name: "not found", status: http.StatusNotFound, wantErr: "status 404"},
+		{name: "server error", status: http.StatusServiceUnavailable, wantErr: "status 503"},
+		{name: "empty result", wantErr: "no stations found"},
+		{name: "malformed json", body: `[{"name": "broken"`, wantErr: "failed to decode response"},
+		{name: "nothing matches", stations: []Station{{Name: "Sports", Tags: []string{"sports"}, Bitrate: 128}}, wantErr: "no stations found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeRadioBrowser(t, tt.stations...)
+			fake.status = tt.status
+			fake.rawBody = tt.body
+			client, _ := newTestClient(fake)
+
+			station, err := client.FetchStation(nil)
+			if err == nil {
+				t.Fatalf("FetchStation returned %+v, want an error", station)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientFailsOverToNextMirror(t *testing.T) {
+	down := newFakeRadioBrowser(t)
+	down.status = http.StatusBadGateway
+	up := newFakeRadioBrowser(t, Station{Name: "Groove", URL: "https://groove.example/stream", Bitrate: 128})
+
+	client, clock := newTestClient(up)
+	client.BaseURL = ""
+	client.servers.servers = []*server{{url: down.URL}, {url: up.URL}}
+	client.servers.fetchedAt = clock.Now()
+
+	station, err := client.FetchStation(nil)
+	if err != nil {
+		t.Fatalf("FetchStation failed: %v", err)
+	}
+	if station.Name != "Groove" {
+		t.Errorf("FetchStation returned %q", station.Name)
+	}
+
+	// the broken mirror is now backing off, so it shouldn't be asked again
+	if _, err := client.FetchStation(nil); err != nil {
+		t.Fatalf("second FetchStation failed: %v", err)
+	}
+	if down.requests() != 1 {
+		t.Errorf("broken mirror got %d requests, want 1", down.requests())
+	}
+}
+
+func TestServerPoolRotatesOnFailure(t *testing.T) {
+	fake := newFakeRadioBrowser(t)
+	client, clock := newTestClient(fake)
+	client.BaseURL = ""
+	pool := client.servers
+	pool.servers = []*server{{url: "https://a"}, {url: "https://b"}, {url: "https://c"}}
+	pool.fetchedAt = clock.Now()
+
+	pool.MarkFailed("https://a")
+	pool.MarkFailed("https://b")
+	pool.MarkFailed("https://b")
+
+	got, err := pool.Candidates()
+	if err != nil {
+		t.Fatalf("Candidates failed: %v", err)
+	}
+	want := []string{"https://c", "https://a", "https://b"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Candidates() = %v, want %v", got, want)
+		}
+	}
+
+	// once the backoff has passed "a" is healthy again
+	clock.Advance(minBackoff + time.Second)
+	if got, _ := pool.Candidates(); got[0] != "https://a" {
+		t.Errorf("Candidates() after backoff = %v, want https://a first", got)
+	}
+
+	pool.MarkOK("https://b")
+	if got, _ := pool.Candidates(); got[1] != "https://b" {
+		t.Errorf("Candidates() after MarkOK = %v, want https://b healthy", got)
+	}
+}
+
+func TestServerPoolPinned(t *testing.T) {
+	client := NewClient(ServerOptions{Pinned: "http://localhost:8080/"})
+	server, err := client.servers.Get()
+	if err != nil || server != "http://localhost:8080" {
+		t.Errorf("Get() = %q, %v; want pinned server", server, err)
+	}
+}
+
+func TestServerPoolResolverError(t *testing.T) {
+	fake := newFakeRadioBrowser(t)
+	client, _ := newTestClient(fake)
+	client.BaseURL = ""
+	client.Resolver = &fakeResolver{err: &net.DNSError{Err: "no such host", Name: serverLookupHost}}
+
+	if _, err := client.FetchStation(nil); err == nil || !strings.Contains(err.Error(), "DNS lookup failed") {
+		t.Errorf("FetchStation error = %v, want DNS failure", err)
+	}
+}
+
+func TestServerPoolKeepsStaleListOnError(t *testing.T) {
+	fake := newFakeRadioBrowser(t)
+	client, clock := newTestClient(fake)
+	client.BaseURL = ""
+	client.Resolver = &fakeResolver{err: &net.DNSError{Err: "no such host", Name: serverLookupHost}}
+	pool := client.servers
+	// the list is due a refresh and the lookup fails, but the old list and its backoff still stand
+	pool.servers = []*server{{url: "https://a"}, {url: "https://b"}}
+	pool.fetchedAt = clock.Now().Add(-defaultServerTTL - time.Second)
+	pool.MarkFailed("https://a")
+
+	got, err := pool.Candidates()
+	if err != nil {
+		t.Fatalf("Candidates failed: %v", err)
+	}
+	if len(got) != 2 || got[0] != "https://b" || got[1] != "https://a" {
+		t.Errorf("Candidates() = %v, want [https://b https://a]", got)
+	}
+	if pool.servers[0].failures != 1 {
+		t.Errorf("https://a has %d failures, want 1", pool.servers[0].failures)
+	}
+}
+
+func TestProfileMatches(t *testing.T) {
+	profile := FilterProfile{
+		Name:        "jazz",
+		Tags:        []string{"jazz", "bebop"},
+		ExcludeTags: []string{"talk"},
+		Countries:   []string{"JP"},
+		Codecs:      []string{"AAC"},
+		MinBitrate:  96,
+		HTTPSOnly:   true,
+	}
+	good := Station{Name: "Jazz Tokyo", URL: "https://example.jp/stream", Tags: []string{"Jazz", "smooth"}, CountryCode: "JP", Codec: "aac", Bitrate: 128}
+
+	tests := []struct {
+		name   string
+		modify func(s *Station)
+		want   bool
+	}{
+		{"matches", func(s *Station) {}, true},
+		{"missing tag", func(s *Station) { s.Tags = []string{"rock"} }, false},
+		{"excluded tag", func(s *Station) { s.Tags = []string{"jazz", "talk"} }, false},
+		{"wrong country", func(s *Station) { s.CountryCode = "US" }, false},
+		{"wrong codec", func(s *Station) { s.Codec = "MP3" }, false},
+		{"low bitrate", func(s *Station) { s.Bitrate = 64 }, false},
+		{"plain http", func(s *Station) { s.URL = "http://example.jp/stream" }, false},
+	}
+	for _, tt := range tests {
+		station := good
+		tt.modify(&station)
+		if got := profile.Matches(&station); got != tt.want {
+			t.Errorf("%s: Matches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStationDecode(t *testing.T) {
+	body := `{"stationuuid":"9617a958-0601-11e8-ae97-52543be04c81","name":" Radio Paradise ","url":"http://stream.radioparadise.com/aac-128",
+		"url_resolved":"https://stream.radioparadise.com/aac-128","homepage":"https://radioparadise.com/","favicon":"https://radioparadise.com/favicon.ico",
+		"tags":"eclectic,rock, world","country":"The United States Of America","countrycode":"US","state":"California",
+		"language":"english","codec":"AAC","bitrate":128,"hls":0,"votes":12345,"clickcount":678,"geo_lat":39.76,"geo_long":null,"lastcheckok":1}`
+
+	var s Station
+	if err := json.Unmarshal([]byte(body), &s); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if s.Name != "Radio Paradise" || s.UUID != "9617a958-0601-11e8-ae97-52543be04c81" || s.CountryCode != "US" {
+		t.Errorf("unexpected station %+v", s)
+	}
+	if len(s.Tags) != 3 || s.Tags[2] != "world" || len(s.Languages) != 1 {
+		t.Errorf("tags/languages not split: %q %q", s.Tags, s.Languages)
+	}
+	if s.HLS || !s.LastCheckOK || s.GeoLat == nil || *s.GeoLat != 39.76 || s.GeoLong != nil {
+		t.Errorf("flags/geo not decoded: %+v", s)
+	}
+	if s.StreamURL() != "https://stream.radioparadise.com/aac-128" {
+		t.Errorf("StreamURL() = %s", s.StreamURL())
+	}
+
+	// a saved station has to come back exactly the same
+	saved, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var again Station
+	if err := json.Unmarshal(saved, &again); err != nil {
+		t.Fatalf("Unmarshal of saved station failed: %v", err)
+	}
+	if !reflect.DeepEqual(again, s) {
+		t.Errorf("round trip changed the station:\n%+v\n%+v", s, again)
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	q, err := ParseSearchQuery([]string{"smooth", "jazz", "country=JP", "codec=aac", "bitrate=128"})
+	if err != nil {
+		t.Fatalf("ParseSearchQuery failed: %v", err)
+	}
+	want := SearchQuery{Tag: "smooth jazz", Country: "JP", Codec: "aac", MinBitrate: 128, Limit: SearchPageSize}
+	if q != want {
+		t.Errorf("ParseSearchQuery = %+v, want %+v", q, want)
+	}
+
+	for _, args := range [][]string{{}, {"bitrate=fast"}, {"colour=blue"}} {
+		if _, err := ParseSearchQuery(args); err == nil {
+			t.Errorf("ParseSearchQuery(%q) should fail", args)
+		}
+	}
+}
+
+func TestClientSearch(t *testing.T) {
+	fake := newFakeRadioBrowser(t,
+		Station{Name: "Jazz Tokyo", Tags: []string{"jazz"}, Votes: 900},
+		Station{Name: "Jazz Osaka", Tags: []string{"jazz"}, Votes: 100},
+	)
+	client, _ := newTestClient(fake)
+
+	q, _ := ParseSearchQuery([]string{"jazz", "country=jp"})
+	stations, err := client.Search(q.Next())
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(stations) != 2 || stations[0].Name != "Jazz Tokyo" {
+		t.Errorf("Search returned %+v", stations)
+	}
+
+	got := fake.lastQuery()
+	want := map[string]string{"tag": "jazz", "countrycode": "JP", "order": "votes", "reverse": "true", "offset": "10", "limit": "10"}
+	for key, value := range want {
+		if got.Get(key) != value {
+			t.Errorf("%s = %q, want %q", key, got.Get(key), value)
+		}
+	}
+}
+
+func TestClientSkipsBlockedStations(t *testing.T) {
+	fake := newFakeRadioBrowser(t,
+		Station{UUID: "awful", Name: "All Ads FM", Bitrate: 128},
+		Station{UUID: "good", Name: "Groove", Bitrate: 128},
+	)
+	client, _ := newTestClient(fake)
+	client.Blocked = func(s *Station) bool { return s.UUID == "awful" }
+
+	station, err := client.FetchStation(nil)
+	if err != nil || station.UUID != "good" {
+		t.Errorf("FetchStation = %v, %v; want the unblocked station", station, err)
+	}
+	results, err := client.Search(SearchQuery{Name: "fm"})
+	if err != nil || len(results) != 1 || results[0].UUID != "good" {
+		t.Errorf("Search = %v, %v; want only the unblocked station", results, err)
+	}
 }
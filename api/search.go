@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SearchPageSize is how many stations one page of search results holds
+const SearchPageSize = 10
+
+// SearchQuery describes a station search. Free text in the REPL is matched against tags,
+// since that's where radio-browser keeps genres.
+type SearchQuery struct {
+	Name       string
+	Tag        string
+	Country    string // two letter codes are matched against countrycode
+	State      string
+	Language   string
+	Codec      string
+	MinBitrate int
+	Order      string // any radio-browser order field, defaults to votes
+	Offset     int
+	Limit      int
+}
+
+// ParseSearchQuery turns REPL arguments like `jazz country=JP codec=aac` into a query
+func ParseSearchQuery(args []string) (SearchQuery, error) {
+	q := SearchQuery{Limit: SearchPageSize}
+	var words []string
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if !found {
+			words = append(words, arg)
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "name":
+			q.Name = value
+		case "tag":
+			q.Tag = value
+		case "country":
+			q.Country = value
+		case "state":
+			q.State = value
+		case "language", "lang":
+			q.Language = value
+		case "codec":
+			q.Codec = value
+		case "bitrate":
+			bitrate, err := strconv.Atoi(value)
+			if err != nil {
+				return q, fmt.Errorf("bitrate must be a number: %q", value)
+			}
+			q.MinBitrate = bitrate
+		case "order":
+			q.Order = value
+		default:
+			return q, fmt.Errorf("unknown search filter %q", key)
+		}
+	}
+	if len(words) > 0 {
+		if q.Tag != "" {
+			q.Name = strings.Join(words, " ")
+		} else {
+			q.Tag = strings.Join(words, " ")
+		}
+	}
+	if q == (SearchQuery{Limit: SearchPageSize}) {
+		return q, errors.New("search needs at least one term or filter")
+	}
+	return q, nil
+}
+
+// Next returns the query for the following page of results
+func (q SearchQuery) Next() SearchQuery {
+	q.Offset += q.limit()
+	return q
+}
+
+func (q SearchQuery) limit() int {
+	if q.Limit <= 0 {
+		return SearchPageSize
+	}
+	return q.Limit
+}
+
+func (q SearchQuery) values() url.Values {
+	v := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set("name", q.Name)
+	set("tag", q.Tag)
+	if len(q.Country) == 2 {
+		set("countrycode", strings.ToUpper(q.Country))
+	} else {
+		set("country", q.Country)
+	}
+	set("state", q.State)
+	set("language", q.Language)
+	set("codec", q.Codec)
+	if q.MinBitrate > 0 {
+		v.Set("bitrateMin", fmt.Sprint(q.MinBitrate))
+	}
+
+	order := q.Order
+	if order == "" {
+		order = "votes"
+	}
+	v.Set("order", order)
+	if order != "random" && order != "name" {
+		// most popular first
+		v.Set("reverse", "true")
+	}
+	v.Set("hidebroken", "true")
+	v.Set("offset", fmt.Sprint(q.Offset))
+	v.Set("limit", fmt.Sprint(q.limit()))
+	return v
+}
+
+// Search returns one page of stations matching the query, ranked by the query's order
+func (c *Client) Search(q SearchQuery) ([]Station, error) {
+	var stations []Station
+	err := c.tryServers(func(server string) error {
+		var err error
+		stations, err = c.searchOn(server, q)
+		return err
+	})
+	return stations, err
+}
+
+func (c *Client) searchOn(server string, q SearchQuery) ([]Station, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("error building API url: %w", err)
+	}
+	u.Path = "/json/stations/search"
+	u.RawQuery = q.values().Encode()
+
+	resp, err := c.get(context.Background(), u.String())
+	if err != nil {
+		return nil, &serverError{fmt.Errorf("search request failed: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("search request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		if resp.StatusCode >= 500 {
+			return nil, &serverError{err}
+		}
+		return nil, err
+	}
+
+	var stations []Station
+	if err := json.NewDecoder(resp.Body).Decode(&stations); err != nil {
+		return nil, fmt.Errorf("failed to decode search results: %w", err)
+	}
+
+	allowed := stations[:0]
+	for i := range stations {
+		if !c.isBlocked(&stations[i]) {
+			allowed = append(allowed, stations[i])
+		}
+	}
+	return allowed, nil
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	serverLookupHost = "all.api.radio-browser.info"
+	defaultServerTTL = time.Hour
+	probeTimeout     = 3 * time.Second
+	minBackoff       = 30 * time.Second
+	maxBackoff       = 10 * time.Minute
+)
+
+// ServerOptions controls how radio-browser mirrors are picked. Pinned skips discovery
+// entirely and can point at a specific mirror or a self-hosted instance.
+type ServerOptions struct {
+	Pinned     string `json:"pinned,omitempty"`
+	TTLMinutes int    `json:"ttl_minutes,omitempty"`
+}
+
+type server struct {
+	url      string
+	latency  time.Duration
+	failures int
+	retryAt  time.Time
+}
+
+// ServerPool keeps the list of known radio-browser mirrors, ordered by latency,
+// and rotates away from mirrors that fail until their backoff runs out.
+type ServerPool struct {
+	client    *Client
+	mu        sync.Mutex
+	servers   []*server
+	fetchedAt time.Time
+	ttl       time.Duration
+}
+
+func newServerPool(client *Client, opts ServerOptions) *ServerPool {
+	ttl := defaultServerTTL
+	if opts.TTLMinutes > 0 {
+		ttl = time.Duration(opts.TTLMinutes) * time.Minute
+	}
+	return &ServerPool{client: client, ttl: ttl}
+}
+
+// Get returns the fastest mirror that isn't backing off, refreshing the list once the TTL runs out
+func (p *ServerPool) Get() (string, error) {
+	candidates, err := p.Candidates()
+	if err != nil {
+		return "", err
+	}
+	return candidates[0], nil
+}
+
+// Candidates returns every usable mirror in the order they should be tried
+func (p *ServerPool) Candidates() ([]string, error) {
+	if p.client.BaseURL != "" {
+		return []string{strings.TrimSuffix(p.client.BaseURL, "/")}, nil
+	}
+
+	now := p.client.Now()
+	p.mu.Lock()
+	stale := len(p.servers) == 0 || now.Sub(p.fetchedAt) > p.ttl
+	p.mu.Unlock()
+	if stale {
+		if err := p.refresh(); err != nil {
+			p.mu.Lock()
+			if len(p.servers) == 0 {
+				p.mu.Unlock()
+				return nil, err
+			}
+			// an old list beats none, try the lookup again after a short wait rather than on every request
+			p.fetchedAt = now.Add(minBackoff - p.ttl)
+			p.mu.Unlock()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var healthy, waiting []*server
+	for _, s := range p.servers {
+		if now.Before(s.retryAt) {
+			waiting = append(waiting, s)
+		} else {
+			healthy = append(healthy, s)
+		}
+	}
+	// if everything is backing off, try the ones that come back soonest rather than giving up
+	sort.SliceStable(waiting, func(i, j int) bool { return waiting[i].retryAt.Before(waiting[j].retryAt) })
+
+	var urls []string
+	for _, s := range append(healthy, waiting...) {
+		urls = append(urls, s.url)
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no valid servers")
+	}
+	return urls, nil
+}
+
+// MarkFailed puts a mirror into exponential backoff
+func (p *ServerPool) MarkFailed(url string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.servers {
+		if s.url == url {
+			s.failures++
+			backoff := minBackoff << (s.failures - 1)
+			if backoff > maxBackoff || backoff <= 0 {
+				backoff = maxBackoff
+			}
+			s.retryAt = p.client.Now().Add(backoff)
+			return
+		}
+	}
+}
+
+// MarkOK clears a mirror's failure count after a successful request
+func (p *ServerPool) MarkOK(url string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.servers {
+		if s.url == url {
+			s.failures = 0
+			s.retryAt = time.Time{}
+			return
+		}
+	}
+}
+
+// refresh discovers the mirrors and probes them all concurrently. Mirrors we already knew
+// keep their failures and backoff, a probe isn't enough to forgive them.
+func (p *ServerPool) refresh() error {
+	urls, err := p.client.lookupServers()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	known := make(map[string]server, len(p.servers))
+	for _, s := range p.servers {
+		known[s.url] = *s
+	}
+	p.mu.Unlock()
+
+	found := make([]*server, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		old := known[u]
+		found[i] = &server{url: u, failures: old.failures, retryAt: old.retryAt}
+		wg.Add(1)
+		go func(s *server) {
+			defer wg.Done()
+			latency, err := p.client.probe(s.url)
+			if err != nil {
+				s.failures = max(s.failures, 1)
+				if retryAt := p.client.Now().Add(minBackoff); retryAt.After(s.retryAt) {
+					s.retryAt = retryAt
+				}
+				return
+			}
+			s.latency = latency
+		}(found[i])
+	}
+	wg.Wait()
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].latency < found[j].latency })
+
+	p.mu.Lock()
+	p.servers = found
+	p.fetchedAt = p.client.Now()
+	p.mu.Unlock()
+	return nil
+}
+
+// lookupServers resolves every mirror behind the round-robin name, falling back to the
+// /json/servers endpoint if reverse DNS doesn't give us anything
+func (c *Client) lookupServers() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	// Perform DNS lookup
+	ips, err := c.Resolver.LookupIP(ctx, "ip", serverLookupHost)
+	if err != nil {
+		return nil, fmt.Errorf("DNS lookup failed: %w", err)
+	}
+
+	// Reverse DNS to get hostnames
+	seen := map[string]bool{}
+	var urls []string
+	for _, ip := range ips {
+		names, err := c.Resolver.LookupAddr(ctx, ip.String())
+		if err != nil || len(names) == 0 {
+			continue
+		}
+		name := strings.TrimSuffix(names[0], ".")
+		if !seen[name] {
+			seen[name] = true
+			urls = append(urls, "https://"+name)
+		}
+	}
+	if len(urls) > 0 {
+		return urls, nil
+	}
+
+	return c.fetchServerList("https://" + serverLookupHost)
+}
+
+// fetchServerList asks a radio-browser instance for the list of mirrors it knows about
+func (c *Client) fetchServerList(baseURL string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	resp, err := c.get(ctx, baseURL+"/json/servers")
+	if err != nil {
+		return nil, fmt.Errorf("server list request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server list request failed with status %d", resp.StatusCode)
+	}
+
+	var list []struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode server list: %w", err)
+	}
+
+	seen := map[string]bool{}
+	var urls []string
+	for _, s := range list {
+		if s.Name != "" && !seen[s.Name] {
+			seen[s.Name] = true
+			urls = append(urls, "https://"+s.Name)
+		}
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no valid servers")
+	}
+	return urls, nil
+}
+
+// probe measures how long a mirror takes to answer a cheap request
+func (c *Client) probe(baseURL string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	start := c.Now()
+	resp, err := c.get(ctx, baseURL+"/json/stats")
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return c.Now().Sub(start), nil
+}
@@ -130,7 +130,18 @@ func DetectSong() (string, string, error) {
 	if err != nil {
 		return "", "", fmt.Errorf("error in RecordClip: %s", err)
 	}
+	return identify()
+}
+
+// DetectSongIn identifies a song from audio taken from the stream
+func DetectSongIn(audio []byte) (string, string, error) {
+	if err := recognition.ClipFrom(audio); err != nil {
+		return "", "", err
+	}
+	return identify()
+}
 
+func identify() (string, string, error) {
 	apiResponse, err := IdentifySong()
 	if err != nil {
 		return "", "", fmt.Errorf("error in IdentifySong: %s", err)
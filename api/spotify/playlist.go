@@ -2,6 +2,7 @@ package spotify
 
 import (
 	"bytes"
+	"cli-radio/icy"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -174,6 +175,22 @@ func GetSongURI(song string) (*Track, error) {
 	return &data.Tracks.Items[0], nil
 }
 
+// FindSong looks up a parsed stream title, searching the track and artist fields
+// first and falling back to a plain search if that finds nothing
+func FindSong(song icy.Title) (*Track, error) {
+	if !song.IsSong() {
+		return nil, fmt.Errorf("not a song: %q", song.Raw)
+	}
+	if song.Artist != "" {
+		unquote := strings.NewReplacer(`"`, "").Replace
+		query := fmt.Sprintf(`track:"%s" artist:"%s"`, unquote(song.Title), unquote(song.Artist))
+		if track, err := GetSongURI(query); err == nil {
+			return track, nil
+		}
+	}
+	return GetSongURI(song.Query())
+}
+
 func CompareSongs(currentSong string, track *Track) int {
 	rawInput := strings.ToLower(strings.TrimSpace(currentSong))
 
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Station is a radio-browser station with the comma separated fields split out
+type Station struct {
+	UUID        string
+	Name        string
+	URL         string
+	URLResolved string
+	Homepage    string
+	Favicon     string
+	Tags        []string
+	Country     string
+	CountryCode string
+	State       string
+	Languages   []string
+	Codec       string
+	Bitrate     int
+	HLS         bool
+	Votes       int
+	ClickCount  int
+	GeoLat      *float64 // nil when the station has no location
+	GeoLong     *float64
+	LastCheckOK bool
+}
+
+// apiStation is the station exactly as radio-browser sends it
+type apiStation struct {
+	UUID        string   `json:"stationuuid"`
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	URLResolved string   `json:"url_resolved"`
+	Homepage    string   `json:"homepage"`
+	Favicon     string   `json:"favicon"`
+	Tags        string   `json:"tags"`
+	Country     string   `json:"country"`
+	CountryCode string   `json:"countrycode"`
+	State       string   `json:"state"`
+	Language    string   `json:"language"`
+	Codec       string   `json:"codec"`
+	Bitrate     int      `json:"bitrate"`
+	HLS         int      `json:"hls"`
+	Votes       int      `json:"votes"`
+	ClickCount  int      `json:"clickcount"`
+	GeoLat      *float64 `json:"geo_lat"`
+	GeoLong     *float64 `json:"geo_long"`
+	LastCheckOK int      `json:"lastcheckok"`
+}
+
+func (s *Station) UnmarshalJSON(data []byte) error {
+	var raw apiStation
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = Station{
+		UUID:        raw.UUID,
+		Name:        strings.TrimSpace(raw.Name),
+		URL:         raw.URL,
+		URLResolved: raw.URLResolved,
+		Homepage:    raw.Homepage,
+		Favicon:     raw.Favicon,
+		Tags:        splitList(raw.Tags),
+		Country:     raw.Country,
+		CountryCode: raw.CountryCode,
+		State:       raw.State,
+		Languages:   splitList(raw.Language),
+		Codec:       raw.Codec,
+		Bitrate:     raw.Bitrate,
+		HLS:         raw.HLS == 1,
+		Votes:       raw.Votes,
+		ClickCount:  raw.ClickCount,
+		GeoLat:      raw.GeoLat,
+		GeoLong:     raw.GeoLong,
+		LastCheckOK: raw.LastCheckOK == 1,
+	}
+	return nil
+}
+
+// MarshalJSON writes the radio-browser format back out, so saved stations decode the same way
+func (s Station) MarshalJSON() ([]byte, error) {
+	return json.Marshal(apiStation{
+		UUID:        s.UUID,
+		Name:        s.Name,
+		URL:         s.URL,
+		URLResolved: s.URLResolved,
+		Homepage:    s.Homepage,
+		Favicon:     s.Favicon,
+		Tags:        strings.Join(s.Tags, ","),
+		Country:     s.Country,
+		CountryCode: s.CountryCode,
+		State:       s.State,
+		Language:    strings.Join(s.Languages, ","),
+		Codec:       s.Codec,
+		Bitrate:     s.Bitrate,
+		HLS:         boolToInt(s.HLS),
+		Votes:       s.Votes,
+		ClickCount:  s.ClickCount,
+		GeoLat:      s.GeoLat,
+		GeoLong:     s.GeoLong,
+		LastCheckOK: boolToInt(s.LastCheckOK),
+	})
+}
+
+// StreamURL prefers the resolved url (playlists already followed) over the one the station submitted
+func (s *Station) StreamURL() string {
+	if s.URLResolved != "" {
+		return s.URLResolved
+	}
+	return s.URL
+}
+
+// Key identifies a station across searches and sessions
+func (s *Station) Key() string {
+	if s.UUID != "" {
+		return s.UUID
+	}
+	return s.StreamURL()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -1,16 +1,121 @@
 package main
 
 import (
+	"bufio"
 	"cli-radio/api"
 	"cli-radio/api/shazam"
 	"cli-radio/api/spotify"
+	"cli-radio/config"
+	"cli-radio/icy"
 	"cli-radio/playback"
+	"cli-radio/store"
+	"errors"
 	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+const (
+	// how much "vol +" and "vol -" turn the current station up or down
+	volumeStep = 5
+	// how much of the time-shift buffer goes to song recognition
+	clipLength = 10 * time.Second
+	// how long the sleep timer fades out and the alarm fades in
+	sleepFade = time.Minute
+	alarmFade = 2 * time.Minute
+	// a scan gives up after this many stations in a row fail to start
+	maxScanFailures = 10
+)
+
+var (
+	// lines carries stdin so the main loop can wait on it and on the player at the same time
+	lines = make(chan string)
+	// keys gets a nudge for every key read, which only comes straight away in cbreak mode
+	keys = make(chan struct{}, 1)
+	// dropLine throws away what's been typed so far, like the key that stopped a scan
+	dropLine atomic.Bool
+)
+
+func readInput() {
+	input := bufio.NewReader(os.Stdin)
+	var line []byte
+	for {
+		b, err := input.ReadByte()
+		if err != nil {
+			if len(line) > 0 {
+				lines <- string(line)
+			}
+			close(lines)
+			return
+		}
+		select {
+		case keys <- struct{}{}:
+		default:
+		}
+		if dropLine.Swap(false) {
+			line = line[:0]
+		}
+		if b == '\n' {
+			lines <- string(line)
+			line = line[:0]
+			continue
+		}
+		line = append(line, b)
+	}
+}
+
+// readLine reads one line from stdin, returning false once stdin is closed
+func readLine() (string, bool) {
+	line, ok := <-lines
+	return strings.TrimSpace(line), ok
+}
+
+// ask prints a question and reads the answer
+func ask(question string) string {
+	fmt.Print(question)
+	response, _ := readLine()
+	return strings.ToLower(response)
+}
+
 func main() {
 	fmt.Println("Welcome")
+	go readInput()
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Error loading config: %s\n", err)
+		return
+	}
+	profile, _ := cfg.Profile(cfg.ActiveProfile)
+	client := api.NewClient(cfg.Servers)
+
+	blocklist, err := store.OpenBlocklist()
+	if err != nil {
+		fmt.Printf("Error loading blocklist: %s\n", err)
+		return
+	}
+	client.Blocked = blocklist.IsBanned
+	queue := api.NewStationQueue(client, profile)
+	defer queue.Close()
+	queue.Prefetch()
+
+	listenLog := store.OpenLog()
+
+	favorites, err := store.OpenFavorites()
+	if err != nil {
+		fmt.Printf("Error loading favorites: %s\n", err)
+		return
+	}
+
+	volume, err := store.OpenVolume()
+	if err != nil {
+		fmt.Printf("Error loading volume settings: %s\n", err)
+		return
+	}
 
 	if err := playback.SetupAudio(); err != nil {
 		fmt.Printf("Error setting up audio device: %s\n", err)
@@ -18,89 +123,493 @@ func main() {
 	}
 	defer playback.RestoreAudio()
 
-	playback.HandleSignals(playback.StopPlayback)
-	var prevFlag bool = false
-	var currentStation, prevStation *api.Station = nil, nil
-	var command string
+	player, err := playback.New(cfg.Player)
+	if err != nil {
+		fmt.Printf("Error setting up player: %s\n", err)
+		return
+	}
+
+	// the listen log follows the player's events, closing the player ends the subscription
+	// and we wait for the last write before exiting
+	logging := player.Subscribe(playback.StationStarted, playback.SongChanged, playback.SongDetected,
+		playback.SongAdded, playback.PlaybackStopped, playback.StreamFailed)
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		for event := range logging.Events() {
+			if err := logEvent(listenLog, event); err != nil {
+				fmt.Printf("\rError writing history log: %s\n> ", err)
+			}
+		}
+	}()
+	closePlayer := func() {
+		player.Close()
+		<-logged
+	}
+	defer closePlayer()
+	recorder := playback.NewRecorder(cfg.Player.Record, player.Publish)
+	// saves the track in progress, before the player and its events go away
+	defer recorder.Stop()
+	playback.HandleSignals(func() {
+		restoreTerminal()
+		recorder.Stop()
+		closePlayer()
+		playback.RestoreAudio()
+	})
+
+	// stations the player gave up on, handled in the main loop so it can move on to the next one
+	failed := player.Subscribe(playback.StreamFailed)
+	// silence, talk and ad breaks, warned about or skipped depending on player.dead_air.action
+	deadAir := player.Subscribe(playback.DeadAir)
+	updates := player.Subscribe(playback.SongChanged, playback.Reconnecting, playback.StreamError,
+		playback.SongRecorded, playback.RecordingStopped)
+	go func() {
+		for event := range updates.Events() {
+			switch event.Kind {
+			case playback.SongChanged:
+				switch event.Song.Kind {
+				case icy.Song:
+					fmt.Printf("\rNow playing: %s\n> ", event.Song)
+				case icy.Ad:
+					fmt.Print("\rAd break.\n> ")
+				case icy.Slogan:
+					fmt.Printf("\rOn air: %s\n> ", event.Title)
+				default:
+					fmt.Print("\rNow playing: song unavailable\n> ")
+				}
+			case playback.Reconnecting:
+				fmt.Printf("\rStream dropped (%v), reconnecting in %s (%d/%d)...\n> ", event.Err, event.Delay, event.Attempt, event.Retries)
+			case playback.StreamError:
+				fmt.Printf("\rPlayback finished with error: %v\n> ", event.Err)
+			case playback.SongRecorded:
+				fmt.Printf("\rSaved %s\n> ", event.Path)
+			case playback.RecordingStopped:
+				if event.Err != nil {
+					fmt.Printf("\rRecording stopped: %v\n> ", event.Err)
+				} else {
+					fmt.Printf("\rStopped recording %s\n> ", event.Station.Name)
+				}
+			}
+		}
+	}()
+
+	var history api.History
+	var lastSearch api.SearchQuery
+	var searchResults []api.Station
+	var shuffle bool
+	var muted bool
+	// set once the sleep timer has handed the audio device back
+	var audioRestored bool
+	timers := playback.NewTimers()
+	// fades started by timers report back here when they're done or cancelled
+	faded := make(chan *playback.Timer)
+	// the scan in progress, nil when we're not scanning
+	var scan *scanState
+	// titles and dropouts tell a scan whether the station is worth stopping on
+	scanEvents := player.Subscribe(playback.SongChanged, playback.Reconnecting)
+
+	// applyVolume sets the player to the current station's volume, or silence while muted
+	applyVolume := func() error {
+		level := volume.For(history.Current())
+		if muted {
+			level = 0
+		}
+		return player.SetVolume(level)
+	}
+
+	// play starts a station, the listen log picks it up from the player's events
+	play := func(label string, station *api.Station) error {
+		fmt.Printf("%s: %s\n", label, station.Name)
+		if audioRestored {
+			if err := playback.SetupAudio(); err != nil {
+				fmt.Printf("Error setting up audio device: %s\n", err)
+			}
+			audioRestored = false
+		}
+		// a recording follows the station it started on, not the player
+		recorder.Stop()
+		// backends that can't change volume mid-stream still pick it up here
+		applyVolume()
+		err := player.Play(station)
+		if err != nil {
+			fmt.Printf("Error starting playback: %s\n", err)
+		}
+		return err
+	}
+	stop := func() {
+		if err := player.Stop(); err != nil {
+			fmt.Println(err)
+		}
+	}
+	// detectSong identifies what's playing from the time-shift buffer when there is one,
+	// otherwise from what comes out of the speakers
+	detectSong := func() (string, string, error) {
+		if clip, err := player.Clip(clipLength); err == nil {
+			return shazam.DetectSongIn(clip)
+		}
+		return shazam.DetectSong()
+	}
+	// songAdded and songDetected tell the listen log, and anyone else listening, about the playlist
+	songAdded := func(title string) {
+		player.Publish(playback.Event{Kind: playback.SongAdded, Title: title, Station: history.Current()})
+	}
+	songDetected := func(title string) {
+		player.Publish(playback.Event{Kind: playback.SongDetected, Title: title, Station: history.Current()})
+	}
+
+	// nextStation finds somewhere new to go, mixing in favorites when shuffle is on
+	nextStation := func() (*api.Station, error) {
+		if shuffle && rand.Float64() < cfg.Favorites.ShuffleRatio {
+			if station, ok := favorites.Random(history.Current()); ok {
+				return station, nil
+			}
+		}
+		return queue.Next()
+	}
+
+	// advance moves on to the next station, walking forward again first if we went back
+	advance := func() {
+		newStation, ok := history.Forward()
+		if !ok {
+			var err error
+			newStation, err = nextStation()
+			if err != nil {
+				fmt.Printf("Error fetching station: %v\n", err)
+				return
+			}
+			history.Visit(newStation)
+		}
+		play("Playing next", newStation)
+	}
+
+	// alarmStation picks what an alarm plays: a favorite, the next station from a profile,
+	// or whatever played last
+	alarmStation := func(target string) (*api.Station, error) {
+		if target == "" {
+			if current := history.Current(); current != nil {
+				return current, nil
+			}
+			return nextStation()
+		}
+		if station, ok := findFavorite(favorites, target); ok {
+			return station, nil
+		}
+		if p, ok := cfg.Profile(target); ok {
+			// a queue of its own, 'next' stays on the active profile
+			alarmQueue := api.NewStationQueue(client, p)
+			defer alarmQueue.Close()
+			return alarmQueue.Next()
+		}
+		return nil, fmt.Errorf("no favorite or profile called %q", target)
+	}
+
+	// stopScan leaves the scan on whatever is playing
+	stopScan := func() {
+		if scan.keys {
+			restoreTerminal()
+			// the key that stopped it isn't the start of a command
+			dropLine.Store(true)
+		}
+		if scan.queue != nil {
+			scan.queue.Close()
+		}
+		scan = nil
+		if current := history.Current(); current != nil {
+			fmt.Printf("\rStopped scanning, staying on %s\n", current.Name)
+		}
+	}
+	// scanNext moves the scan on, skipping stations that won't start
+	scanNext := func() {
+		for failures := 0; failures < maxScanFailures; failures++ {
+			var station *api.Station
+			if scan.stations != nil {
+				if len(scan.stations) == 0 {
+					fmt.Println("That's all the search results")
+					stopScan()
+					return
+				}
+				station, scan.stations = &scan.stations[0], scan.stations[1:]
+			} else {
+				var err error
+				if scan.queue != nil {
+					station, err = scan.queue.Next()
+				} else {
+					station, err = nextStation()
+				}
+				if err != nil {
+					fmt.Printf("Error fetching station: %v\n", err)
+					stopScan()
+					return
+				}
+			}
+			history.Visit(station)
+			if play("Scanning", station) != nil {
+				continue
+			}
+			scan.heard = false
+			scan.next = time.After(scan.interval)
+			scan.titles = time.After(min(scan.interval, scan.wait))
+			return
+		}
+		fmt.Printf("%d stations in a row wouldn't start\n", maxScanFailures)
+		stopScan()
+	}
 
 	spotify.Authenticate()
 
 	for {
 		fmt.Print("> ")
-		_, err := fmt.Scanln(&command)
-		if err != nil {
-			fmt.Println("Input not valid. Try again.")
+		var line string
+		// only a scan has anything to say on these, nil channels never fire
+		var scanTick, scanTitles <-chan time.Time
+		var scanKeys <-chan struct{}
+		if scan != nil {
+			scanTick, scanTitles = scan.next, scan.titles
+			if scan.keys {
+				scanKeys = keys
+			}
+		}
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				stop()
+				return
+			}
+			line = strings.TrimSpace(l)
+		case event := <-failed.Events():
+			current := history.Current()
+			if current == nil || event.Station == nil || current.Key() != event.Station.Key() {
+				// we already left that station
+				continue
+			}
+			fmt.Printf("\r%s keeps dropping (%v), moving on\n", current.Name, event.Err)
+			if scan != nil {
+				scanNext()
+				continue
+			}
+			advance()
+			continue
+		case event := <-deadAir.Events():
+			current := history.Current()
+			if current == nil || event.Station == nil || current.Key() != event.Station.Key() {
+				continue
+			}
+			what := deadAirMessage(event)
+			if !cfg.Player.DeadAir.Skip() {
+				fmt.Printf("\r%s: %s\n", current.Name, what)
+				continue
+			}
+			fmt.Printf("\r%s: %s, skipping\n", current.Name, what)
+			if scan != nil {
+				scanNext()
+				continue
+			}
+			advance()
+			continue
+		case event := <-scanEvents.Events():
+			current := history.Current()
+			if scan == nil || current == nil || event.Station == nil || current.Key() != event.Station.Key() {
+				continue
+			}
+			if event.Kind == playback.Reconnecting {
+				fmt.Printf("\r%s dropped, skipping\n", current.Name)
+				scanNext()
+				continue
+			}
+			if event.Song.IsSong() {
+				scan.heard = true
+			}
+			continue
+		case <-scanTitles:
+			scan.titles = nil
+			if !scan.heard {
+				fmt.Printf("\rNo song titles from %s, skipping\n", history.Current().Name)
+				scanNext()
+			}
+			continue
+		case <-scanTick:
+			fmt.Print("\r")
+			scanNext()
+			continue
+		case <-scanKeys:
+			stopScan()
+			continue
+		case timer := <-timers.Due():
+			ctx := timer.Context()
+			switch timer.Kind {
+			case playback.SleepTimer:
+				fmt.Print("\rSleep timer: fading out...\n")
+				from := player.State().Volume
+				go func() {
+					player.Fade(ctx, from, 0, timer.Fade)
+					faded <- timer
+				}()
+			case playback.AlarmTimer:
+				station, err := alarmStation(timer.Target)
+				if err != nil {
+					fmt.Printf("\rAlarm: %v\n", err)
+					timers.Finish(timer)
+					continue
+				}
+				fmt.Print("\r")
+				if scan != nil {
+					stopScan()
+				}
+				if station != history.Current() {
+					history.Visit(station)
+				}
+				// start silent and let the fade bring it up, unless it was muted to begin with
+				wasMuted := muted
+				muted = true
+				play("Alarm", station)
+				muted = wasMuted
+				if muted {
+					fmt.Println("Alarm: muted, 'unmute' to hear it")
+					timers.Finish(timer)
+					continue
+				}
+				to := volume.For(station)
+				go func() {
+					player.Fade(ctx, 0, to, timer.Fade)
+					faded <- timer
+				}()
+			}
+			continue
+		case timer := <-faded:
+			cancelled := timer.Context().Err() != nil
+			timers.Finish(timer)
+			if cancelled {
+				applyVolume()
+				continue
+			}
+			if timer.Kind == playback.SleepTimer {
+				if scan != nil {
+					stopScan()
+				}
+				stop()
+				recorder.Stop()
+				playback.RestoreAudio()
+				audioRestored = true
+				fmt.Print("\rSleep timer: playback stopped. Good night\n")
+			}
 			continue
 		}
+		if scan != nil {
+			// anything typed ends the scan, and 'stop' does nothing else
+			stopScan()
+			if line == "stop" {
+				continue
+			}
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		command, args := fields[0], fields[1:]
 
 		switch command {
 		case "p", "play":
-			station, err := api.FetchStation()
-			if err != nil {
-				fmt.Printf("Error fetching station: %v\n", err)
+			if len(args) > 1 && args[0] == "fav" {
+				n, err := strconv.Atoi(args[1])
+				if err != nil {
+					fmt.Println("Usage: play fav <n> (see 'favs')")
+					continue
+				}
+				station, err := favorites.Get(n)
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				history.Visit(station)
+				play("Playing", station)
 				continue
 			}
-			currentStation = station
-			fmt.Printf("Playing: %s\n", station.Name)
-			playback.PlayStation(station.URL, station.Name)
-		case "n", "next":
-			var newStation *api.Station
-			if prevFlag {
-				newStation = currentStation
-				prevFlag = false
-			} else {
-				newStation, err = api.FetchStation()
-				if err != nil {
-					fmt.Printf("Error fetching station: %v\n", err)
+			if len(args) > 0 {
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 1 || n > len(searchResults) {
+					fmt.Println("Pick a number from the search results")
 					continue
 				}
+				station := searchResults[n-1]
+				history.Visit(&station)
+				play("Playing", &station)
+				continue
 			}
-			prevStation = currentStation
-			currentStation = newStation
-			fmt.Printf("Playing next: %s\n", newStation.Name)
-			playback.PlayStation(newStation.URL, newStation.Name)
+			station, err := nextStation()
+			if err != nil {
+				fmt.Printf("Error fetching station: %v\n", err)
+				continue
+			}
+			history.Visit(station)
+			play("Playing", station)
+		case "n", "next":
+			advance()
 		case "pr", "prev":
-			if prevStation == nil {
+			prevStation, ok := history.Back()
+			if !ok {
 				fmt.Println("No previous stations")
 				continue
-			} else if prevFlag {
-				fmt.Println("Can't go back any more")
-				fmt.Printf("Still playing: %s\n", prevStation.Name)
+			}
+			play("Playing previous", prevStation)
+		case "h", "history":
+			heard := history.Heard()
+			if len(heard) == 0 {
+				fmt.Println("No stations played yet")
+				continue
+			}
+			for i, s := range heard {
+				marker := " "
+				if s == history.Current() {
+					marker = "*"
+				}
+				fmt.Printf("%s%3d. %s\n", marker, i+1, s.Name)
+			}
+		case "goto":
+			if len(args) == 0 {
+				fmt.Println("Usage: goto <n> (see 'history')")
+				continue
+			}
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				fmt.Println("Usage: goto <n> (see 'history')")
+				continue
+			}
+			station, err := history.Goto(n)
+			if err != nil {
+				fmt.Println(err)
 				continue
 			}
-			prevFlag = true
-			fmt.Printf("Playing previous: %s\n", prevStation.Name)
-			playback.PlayStation(prevStation.URL, prevStation.Name)
+			play("Playing", station)
 		case "a", "add":
-			currentSong := playback.GetCurrentSong()
-			if strings.ToLower(currentSong) == "song unavailable" || strings.TrimSpace(currentSong) == "" {
+			song := player.State().Song
+			if !song.IsSong() {
 				fmt.Println("Song not currently available. Wait for a track to play to add.")
 				continue
 			}
-			track, err := spotify.GetSongURI(currentSong)
+			currentSong := song.String()
+			track, err := spotify.FindSong(song)
 			if err != nil {
 				fmt.Printf("Error getting song URI: %s\n", err)
+				continue
 			}
 
-			if spotify.CompareSongs(currentSong, track) > (len(strings.TrimSpace(currentSong)) / 2) {
-				fmt.Printf("The song we found seems to be a bit different than we expected.\nFound: %s by %s\nProceed? (y/n): ", track.Name, track.Artists[0].Name)
-				var response string
-				fmt.Scanln(&response)
-				if strings.ToLower(response) != "y" {
-					fmt.Printf("Would you like to detect the song with Shazam instead? (y/n): ")
-					fmt.Scanln(&response)
-					if response == "y" {
-						detectedURI, detectedTitle, err := shazam.DetectSong()
+			if spotify.CompareSongs(currentSong, track) > (len(currentSong) / 2) {
+				response := ask(fmt.Sprintf("The song we found seems to be a bit different than we expected.\nFound: %s by %s\nProceed? (y/n): ", track.Name, track.Artists[0].Name))
+				if response != "y" {
+					if ask("Would you like to detect the song with Shazam instead? (y/n): ") == "y" {
+						detectedURI, detectedTitle, err := detectSong()
 						if err != nil || detectedURI == "" {
 							fmt.Printf("Could not detect the song with Shazam: %s\n", err)
 							continue
 						}
+						songDetected(detectedTitle)
 						fmt.Printf("Adding %s\n", detectedTitle)
 						msg, err := spotify.AddToPlaylist(detectedURI)
 						if err != nil {
 							fmt.Printf("Error adding to playlist: %s\n", err)
 							continue
 						}
+						songAdded(detectedTitle)
 						fmt.Println(msg)
 					}
 					continue
@@ -111,41 +620,630 @@ func main() {
 				fmt.Printf("Error adding to playlist: %s\n", err)
 				continue
 			}
+			songAdded(currentSong)
 			fmt.Println(msg)
 		case "d", "detect":
 			fmt.Println("Detecting song using Shazam...")
-			songURI, songTitle, err := shazam.DetectSong()
+			songURI, songTitle, err := detectSong()
 			if err != nil || songTitle == "" {
 				fmt.Printf("Could not detect the song with Shazam: %s\n", err)
 				continue
 			}
 
+			songDetected(songTitle)
 			fmt.Printf("Detected song: %s\n", songTitle)
-			fmt.Printf("Would you like to add it to playlist? (y/n): ")
-
-			var response string
-			fmt.Scanln(&response)
-			if response == "y" {
+			if ask("Would you like to add it to playlist? (y/n): ") == "y" {
 				msg, err := spotify.AddToPlaylist(songURI)
 				if err != nil {
 					fmt.Printf("Error: %s\n", err)
 				} else {
+					songAdded(songTitle)
 					fmt.Println(msg)
 				}
 			} else {
 				fmt.Println("Not adding...")
 			}
 
+		case "f", "fav":
+			current := history.Current()
+			if current == nil {
+				fmt.Println("Nothing playing")
+				continue
+			}
+			added, err := favorites.Add(current)
+			if err != nil {
+				fmt.Printf("Error saving favorite: %s\n", err)
+			} else if !added {
+				fmt.Printf("%s is already a favorite\n", current.Name)
+			} else {
+				fmt.Printf("Saved %s to favorites\n", current.Name)
+			}
+		case "unfav":
+			station := history.Current()
+			if len(args) > 0 {
+				n, err := strconv.Atoi(args[0])
+				if err != nil {
+					fmt.Println("Usage: unfav [n] (see 'favs')")
+					continue
+				}
+				if station, err = favorites.Get(n); err != nil {
+					fmt.Println(err)
+					continue
+				}
+			}
+			if station == nil {
+				fmt.Println("Nothing playing")
+				continue
+			}
+			removed, err := favorites.Remove(station)
+			if err != nil {
+				fmt.Printf("Error removing favorite: %s\n", err)
+			} else if !removed {
+				fmt.Printf("%s isn't a favorite\n", station.Name)
+			} else {
+				fmt.Printf("Removed %s from favorites\n", station.Name)
+			}
+		case "favs":
+			favs := favorites.List()
+			if len(favs) == 0 {
+				fmt.Println("No favorites yet, use 'fav' to save the current station")
+				continue
+			}
+			for i, s := range favs {
+				fmt.Printf("%3d. %s [%s %dk] %s\n", i+1, s.Name, s.Codec, s.Bitrate, s.CountryCode)
+			}
+			fmt.Println("'play fav <n>' to listen")
+		case "shuffle":
+			if len(args) > 0 {
+				shuffle = args[0] == "on"
+			} else {
+				shuffle = !shuffle
+			}
+			if shuffle {
+				fmt.Printf("Shuffle on: about %.0f%% of next stations will be favorites\n", cfg.Favorites.ShuffleRatio*100)
+			} else {
+				fmt.Println("Shuffle off")
+			}
+		case "ban":
+			current := history.Current()
+			if current == nil {
+				fmt.Println("Nothing playing")
+				continue
+			}
+			if _, err := blocklist.Ban(current); err != nil {
+				fmt.Printf("Error saving ban: %s\n", err)
+				continue
+			}
+			fmt.Printf("Banned %s, skipping...\n", current.Name)
+			advance()
+		case "bans":
+			bans := blocklist.List()
+			if len(bans) == 0 {
+				fmt.Println("No banned stations")
+				continue
+			}
+			for i, b := range bans {
+				fmt.Printf("%3d. %s (banned %s)\n", i+1, b.Name, b.BannedAt.Format("2006-01-02"))
+			}
+			fmt.Println("'unban <n>' to let a station back in")
+		case "unban":
+			if len(args) == 0 {
+				fmt.Println("Usage: unban <n> (see 'bans')")
+				continue
+			}
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				fmt.Println("Usage: unban <n> (see 'bans')")
+				continue
+			}
+			removed, err := blocklist.Unban(n)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("Unbanned %s\n", removed.Name)
+		case "s", "search":
+			query, err := api.ParseSearchQuery(args)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			results, err := client.Search(query)
+			if err != nil {
+				fmt.Printf("Error searching stations: %v\n", err)
+				continue
+			}
+			lastSearch, searchResults = query, results
+			printSearchResults(results, 0)
+		case "more":
+			if len(searchResults) == 0 {
+				fmt.Println("Search for something first")
+				continue
+			}
+			query := lastSearch.Next()
+			results, err := client.Search(query)
+			if err != nil {
+				fmt.Printf("Error searching stations: %v\n", err)
+				continue
+			}
+			lastSearch = query
+			printSearchResults(results, len(searchResults))
+			searchResults = append(searchResults, results...)
+		case "log":
+			query, err := store.ParseQuery(args, time.Now())
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			listens, err := listenLog.Listens(query)
+			if err != nil {
+				fmt.Printf("Error reading history log: %s\n", err)
+				continue
+			}
+			if len(listens) == 0 {
+				fmt.Println("Nothing in the log matches")
+				continue
+			}
+			printListens(listens)
+		case "vol", "volume":
+			current := history.Current()
+			if len(args) == 0 {
+				printVolume(volume, current, muted)
+				continue
+			}
+			if arg := args[0]; strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-") {
+				if current == nil {
+					fmt.Println("Nothing playing, use 'vol <0-100>' to set the master volume")
+					continue
+				}
+				delta, err := strconv.Atoi(arg)
+				if arg == "+" || arg == "-" {
+					delta, err = volumeStep, nil
+					if arg == "-" {
+						delta = -volumeStep
+					}
+				}
+				if err != nil {
+					fmt.Println("Usage: vol <0-100> | vol + | vol - | vol +<n> | vol -<n>")
+					continue
+				}
+				if _, err := volume.Adjust(current, delta); err != nil {
+					fmt.Printf("Error saving volume: %s\n", err)
+				}
+			} else {
+				n, err := strconv.Atoi(arg)
+				if err != nil || n < 0 || n > 100 {
+					fmt.Println("Usage: vol <0-100> | vol + | vol - | vol +<n> | vol -<n>")
+					continue
+				}
+				if err := volume.SetMaster(n); err != nil {
+					fmt.Printf("Error saving volume: %s\n", err)
+				}
+			}
+			muted = false
+			if err := applyVolume(); err != nil {
+				fmt.Println(err)
+			}
+			printVolume(volume, current, muted)
+		case "mute", "unmute":
+			muted = command == "mute" && !muted
+			if err := applyVolume(); err != nil {
+				fmt.Println(err)
+			}
+			if muted {
+				fmt.Println("Muted, 'mute' again to unmute")
+			} else {
+				printVolume(volume, history.Current(), muted)
+			}
+		case "eq":
+			if len(args) == 0 {
+				for _, name := range playback.EQNames() {
+					marker := " "
+					if name == player.State().EQ {
+						marker = "*"
+					}
+					fmt.Printf("%s %s\n", marker, name)
+				}
+				continue
+			}
+			err := player.SetEQ(args[0])
+			switch {
+			case errors.Is(err, errors.ErrUnsupported):
+				// the player keeps the preset for the next station
+				fmt.Printf("EQ set to %s, this player can't change it mid-stream so it starts with the next station\n", player.State().EQ)
+			case err != nil:
+				fmt.Println(err)
+			default:
+				fmt.Printf("EQ set to %s\n", player.State().EQ)
+			}
+		case "rec", "record":
+			if len(args) > 0 && args[0] == "stop" {
+				if recorder.Station() == nil {
+					fmt.Println("Not recording")
+				}
+				recorder.Stop()
+				continue
+			}
+			current := history.Current()
+			if current == nil {
+				fmt.Println("Nothing playing")
+				continue
+			}
+			if recording := recorder.Station(); recording != nil && recording.Key() == current.Key() {
+				fmt.Printf("Already recording %s, 'rec stop' to finish\n", current.Name)
+				continue
+			}
+			if err := recorder.Start(current); err != nil {
+				fmt.Printf("Error starting recording: %s\n", err)
+				continue
+			}
+			fmt.Printf("Recording %s to %s, starting with the next song. 'rec stop' to finish\n", current.Name, recorder.Dir())
+		case "rw", "rewind":
+			if len(args) == 0 {
+				fmt.Println("Usage: rewind <seconds> | rewind <duration, like 1m30s>")
+				continue
+			}
+			d, err := time.ParseDuration(args[0])
+			if n, convErr := strconv.Atoi(args[0]); convErr == nil {
+				d, err = time.Duration(n)*time.Second, nil
+			}
+			if err != nil || d <= 0 {
+				fmt.Println("Usage: rewind <seconds> | rewind <duration, like 1m30s>")
+				continue
+			}
+			if err := player.Rewind(d); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			behind, _ := player.Behind()
+			fmt.Printf("Rewound, now %s behind live. 'live' to catch up\n", behind.Round(time.Second))
+		case "live":
+			if err := player.Live(); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Println("Back to live")
+		case "pause", "resume":
+			if err := player.Pause(command == "pause"); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if _, reach := player.Behind(); command == "pause" && reach > 0 {
+				fmt.Println("Paused, still buffering. 'resume' to carry on or 'live' to catch up")
+			} else if command == "pause" {
+				fmt.Println("Paused, 'resume' to carry on")
+			} else {
+				fmt.Println("Resumed")
+			}
+		case "i", "info":
+			if history.Current() == nil {
+				fmt.Println("Nothing playing")
+				continue
+			}
+			printStationInfo(history.Current())
+		case "profile":
+			if len(args) == 0 {
+				for _, p := range cfg.Profiles {
+					marker := " "
+					if p.Name == profile.Name {
+						marker = "*"
+					}
+					fmt.Printf("%s %s\n", marker, p.String())
+				}
+				continue
+			}
+			p, ok := cfg.Profile(args[0])
+			if !ok {
+				fmt.Printf("No profile named %q\n", args[0])
+				continue
+			}
+			profile = p
+			queue.SetProfile(profile)
+			fmt.Printf("Switched to profile %s\n", profile.String())
+		case "sleep":
+			if len(args) == 0 {
+				fmt.Println("Usage: sleep <minutes> | sleep <duration, like 1h30m> | sleep off")
+				continue
+			}
+			if args[0] == "off" {
+				if timers.CancelKind(playback.SleepTimer) == 0 {
+					fmt.Println("No sleep timer set")
+				} else {
+					fmt.Println("Sleep timer off")
+				}
+				continue
+			}
+			d, err := time.ParseDuration(args[0])
+			if n, convErr := strconv.Atoi(args[0]); convErr == nil {
+				d, err = time.Duration(n)*time.Minute, nil
+			}
+			if err != nil || d <= 0 {
+				fmt.Println("Usage: sleep <minutes> | sleep <duration, like 1h30m> | sleep off")
+				continue
+			}
+			timer := timers.Add(playback.SleepTimer, time.Now().Add(d), min(sleepFade, d), "")
+			fmt.Printf("Stopping at %s, fading out for the last %s\n", timer.At.Format("15:04"), timer.Fade)
+		case "alarm":
+			if len(args) == 0 {
+				fmt.Println("Usage: alarm <time, like 7:30 or 7am> [favorite name or number | profile] | alarm off")
+				continue
+			}
+			if args[0] == "off" {
+				fmt.Printf("Cancelled %d alarm(s)\n", timers.CancelKind(playback.AlarmTimer))
+				continue
+			}
+			at, err := playback.ParseClock(args[0], time.Now())
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			target := strings.Join(args[1:], " ")
+			if target != "" {
+				_, isFavorite := findFavorite(favorites, target)
+				if _, isProfile := cfg.Profile(target); !isFavorite && !isProfile {
+					fmt.Printf("No favorite or profile called %q\n", target)
+					continue
+				}
+			}
+			timers.Add(playback.AlarmTimer, at, alarmFade, target)
+			fmt.Printf("Alarm set for %s (in %s)\n", at.Format("Mon 15:04"), time.Until(at).Round(time.Minute))
+		case "timers":
+			if len(args) == 2 && args[0] == "cancel" {
+				id, err := strconv.Atoi(args[1])
+				if err != nil {
+					fmt.Println("Usage: timers cancel <n>")
+					continue
+				}
+				if _, ok := timers.Cancel(id); !ok {
+					fmt.Printf("No timer %d\n", id)
+					continue
+				}
+				fmt.Printf("Cancelled timer %d\n", id)
+				continue
+			}
+			list := timers.List()
+			if len(list) == 0 {
+				fmt.Println("No timers set")
+				continue
+			}
+			for _, timer := range list {
+				printTimer(timer)
+			}
+			fmt.Println("'timers cancel <n>' to cancel one")
+		case "scan":
+			next := &scanState{interval: time.Duration(cfg.Scan.Seconds * float64(time.Second)), wait: time.Duration(cfg.Scan.WaitSeconds * float64(time.Second))}
+			usage := false
+			for _, arg := range args {
+				if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+					next.interval = time.Duration(n) * time.Second
+				} else if arg == "results" {
+					next.stations = append([]api.Station{}, searchResults...)
+				} else if p, ok := cfg.Profile(arg); ok {
+					// a queue of its own, 'next' stays on the active profile
+					if next.queue != nil {
+						next.queue.Close()
+					}
+					next.queue = api.NewStationQueue(client, p)
+				} else {
+					usage = true
+				}
+			}
+			if usage || next.stations != nil && len(next.stations) == 0 {
+				if next.queue != nil {
+					next.queue.Close()
+				}
+				if usage {
+					fmt.Println("Usage: scan [seconds] [results | profile]")
+				} else {
+					fmt.Println("Search for something first")
+				}
+				continue
+			}
+			scan = next
+			// drop the nudge from typing 'scan' itself
+			select {
+			case <-keys:
+			default:
+			}
+			if scan.keys = cbreak(); scan.keys {
+				fmt.Printf("Scanning, %s a station. Press any key to stay\n", scan.interval)
+			} else {
+				fmt.Printf("Scanning, %s a station. Enter or 'stop' to stay\n", scan.interval)
+			}
+			scanNext()
+		case "stop":
+			fmt.Println("Not scanning, 'end' stops playback")
 		case "e", "end":
-			playback.StopPlayback()
+			stop()
 			fmt.Println("Playback stopped")
 		case "q", "quit":
-			playback.StopPlayback()
+			queue.Close()
+			stop()
 			fmt.Println("Exiting...")
-			prevStation, currentStation = nil, nil
 			return
 		default:
 			fmt.Println("Invalid Command...")
 		}
 	}
 }
+
+// scanState is a scan in progress
+type scanState struct {
+	// stations to go through, nil to take them from the queue
+	stations []api.Station
+	// queue is set when scanning a profile other than the active one
+	queue    *api.StationQueue
+	interval time.Duration
+	// how long a station gets to send a song title
+	wait time.Duration
+	// next fires when it's time to move on, titles when the station has had its chance to
+	// send a title
+	next, titles <-chan time.Time
+	// heard is set once the current station sends a song title
+	heard bool
+	// keys is set when a single key stops the scan, otherwise it takes a line
+	keys bool
+}
+
+// deadAirMessage says what the dead air watch noticed
+func deadAirMessage(event playback.Event) string {
+	switch event.Reason {
+	case playback.Silence:
+		return "dead air"
+	case playback.NoSongs:
+		return "no songs for a while, probably talk"
+	default:
+		return fmt.Sprintf("looks like an ad or jingle (%s)", event.Title)
+	}
+}
+
+// findFavorite looks up a favorite by its number in 'favs' or by part of its name
+func findFavorite(favorites *store.Favorites, target string) (*api.Station, bool) {
+	if n, err := strconv.Atoi(target); err == nil {
+		station, err := favorites.Get(n)
+		return station, err == nil
+	}
+	for _, s := range favorites.List() {
+		if strings.Contains(strings.ToLower(s.Name), strings.ToLower(target)) {
+			return &s, true
+		}
+	}
+	return nil, false
+}
+
+func printTimer(timer playback.Timer) {
+	left := time.Until(timer.At).Round(time.Second)
+	switch {
+	case timer.Kind == playback.SleepTimer && timer.Fired():
+		fmt.Printf("%3d. sleep: fading out, stops at %s\n", timer.ID, timer.At.Format("15:04"))
+	case timer.Kind == playback.SleepTimer:
+		fmt.Printf("%3d. sleep: stops at %s (in %s)\n", timer.ID, timer.At.Format("15:04"), left)
+	case timer.Fired():
+		fmt.Printf("%3d. alarm: fading in\n", timer.ID)
+	default:
+		target := timer.Target
+		if target == "" {
+			target = "last station"
+		}
+		fmt.Printf("%3d. alarm: %s at %s (in %s)\n", timer.ID, target, timer.At.Format("Mon 15:04"), left)
+	}
+}
+
+// logEvent writes one of the player's events to the listen log
+func logEvent(log *store.Log, event playback.Event) error {
+	switch event.Kind {
+	case playback.StationStarted:
+		return log.StationStarted(event.Station)
+	case playback.SongChanged:
+		if event.Song.IsSong() {
+			return log.SongSeen(event.Song.String())
+		}
+	case playback.SongDetected:
+		return log.SongDetected(event.Title)
+	case playback.SongAdded:
+		return log.SongAdded(event.Title)
+	case playback.PlaybackStopped:
+		if event.Station != nil {
+			return log.Stopped()
+		}
+	case playback.StreamFailed:
+		if event.Station != nil {
+			return log.StationFailed(event.Station, event.Err)
+		}
+	}
+	return nil
+}
+
+// printVolume shows the master volume and how the current station differs from it
+func printVolume(volume *store.Volume, current *api.Station, muted bool) {
+	if muted {
+		fmt.Printf("Muted (volume %d%%)\n", volume.For(current))
+		return
+	}
+	if current == nil || volume.Offset(current) == 0 {
+		fmt.Printf("Volume %d%%\n", volume.For(current))
+		return
+	}
+	fmt.Printf("Volume %d%% (%s %+d from master %d%%)\n", volume.For(current), current.Name, volume.Offset(current), volume.Master())
+}
+
+// printSearchResults lists a page of results, numbered after the ones already shown
+func printSearchResults(results []api.Station, shown int) {
+	if len(results) == 0 {
+		fmt.Println("No more stations found")
+		return
+	}
+	for i, s := range results {
+		fmt.Printf("%3d. %s [%s %dk] %s\n", shown+i+1, s.Name, s.Codec, s.Bitrate, s.CountryCode)
+	}
+	if len(results) == api.SearchPageSize {
+		fmt.Println("'play <n>' to listen, 'more' for the next page")
+	} else {
+		fmt.Println("'play <n>' to listen")
+	}
+}
+
+// printListens shows listens oldest first so the most recent end up next to the prompt
+func printListens(listens []store.Listen) {
+	for i := len(listens) - 1; i >= 0; i-- {
+		l := listens[i]
+		end := "..."
+		if !l.End.IsZero() {
+			end = l.End.Format("15:04")
+		}
+		fmt.Printf("%s-%s  %s", l.Start.Format("Mon 02 Jan 15:04"), end, l.StationName)
+		if l.CountryCode != "" {
+			fmt.Printf(" (%s)", l.CountryCode)
+		}
+		if l.Failed != "" {
+			fmt.Printf(" [failed: %s]", l.Failed)
+		}
+		fmt.Println()
+		for _, song := range l.Songs {
+			var marks string
+			if song.Detected {
+				marks += " [detected]"
+			}
+			if song.Added {
+				marks += " [added]"
+			}
+			fmt.Printf("    %s  %s%s\n", song.At.Format("15:04"), song.Title, marks)
+		}
+	}
+}
+
+func printStationInfo(s *api.Station) {
+	fmt.Printf("Name:       %s\n", s.Name)
+	location := s.Country
+	if s.State != "" {
+		location = s.State + ", " + location
+	}
+	if s.CountryCode != "" {
+		location += " (" + s.CountryCode + ")"
+	}
+	fmt.Printf("Location:   %s\n", location)
+	if s.GeoLat != nil && s.GeoLong != nil {
+		fmt.Printf("Geo:        %.4f, %.4f\n", *s.GeoLat, *s.GeoLong)
+	}
+	fmt.Printf("Languages:  %s\n", strings.Join(s.Languages, ", "))
+	fmt.Printf("Tags:       %s\n", strings.Join(s.Tags, ", "))
+	format := fmt.Sprintf("%s %d kbps", s.Codec, s.Bitrate)
+	if s.HLS {
+		format += " (HLS)"
+	}
+	fmt.Printf("Format:     %s\n", format)
+	fmt.Printf("Stream:     %s\n", s.StreamURL())
+	if s.Homepage != "" {
+		fmt.Printf("Homepage:   %s\n", s.Homepage)
+	}
+	if s.Favicon != "" {
+		fmt.Printf("Favicon:    %s\n", s.Favicon)
+	}
+	fmt.Printf("Popularity: %d votes, %d clicks\n", s.Votes, s.ClickCount)
+	status := "ok"
+	if !s.LastCheckOK {
+		status = "failing"
+	}
+	fmt.Printf("Last check: %s\n", status)
+	fmt.Printf("UUID:       %s\n", s.UUID)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// the terminal settings from before cbreak, "" while the terminal is as we found it
+var (
+	terminalMu    sync.Mutex
+	terminalSaved string
+)
+
+// cbreak hands us every key as it's pressed rather than a line at a time, so a single key
+// can stop a scan. It returns false when stdin isn't a terminal and Enter has to do.
+func cbreak() bool {
+	terminalMu.Lock()
+	defer terminalMu.Unlock()
+	if terminalSaved != "" {
+		return true
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return false
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return false
+	}
+	terminalSaved = strings.TrimSpace(saved)
+	return true
+}
+
+// restoreTerminal undoes cbreak, it's safe to call either way
+func restoreTerminal() {
+	terminalMu.Lock()
+	defer terminalMu.Unlock()
+	if terminalSaved == "" {
+		return
+	}
+	stty(terminalSaved)
+	terminalSaved = ""
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"cli-radio/api"
+	"cli-radio/playback"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var configFile = "config/config.json"
+
+const (
+	defaultShuffleRatio = 0.3
+	defaultScanSeconds  = 10
+	defaultScanWait     = 8
+)
+
+type Config struct {
+	ActiveProfile string              `json:"active_profile"`
+	Profiles      []api.FilterProfile `json:"profiles"`
+	Servers       api.ServerOptions   `json:"servers"`
+	Favorites     FavoritesOptions    `json:"favorites"`
+	Scan          ScanOptions         `json:"scan"`
+	Player        playback.Options    `json:"player"`
+}
+
+type FavoritesOptions struct {
+	// ShuffleRatio is the share of stations in shuffle mode that come from favorites (0-1)
+	ShuffleRatio float64 `json:"shuffle_ratio"`
+}
+
+type ScanOptions struct {
+	// Seconds each station plays for when scanning, unless 'scan <seconds>' says otherwise
+	Seconds float64 `json:"seconds"`
+	// WaitSeconds is how long a station gets to send a song title before it's skipped
+	WaitSeconds float64 `json:"wait_seconds"`
+}
+
+// Default returns the settings used when there is no config file
+func Default() *Config {
+	return &Config{
+		ActiveProfile: api.DefaultProfile.Name,
+		Profiles:      []api.FilterProfile{api.DefaultProfile},
+		Favorites:     FavoritesOptions{ShuffleRatio: defaultShuffleRatio},
+		Scan:          ScanOptions{Seconds: defaultScanSeconds, WaitSeconds: defaultScanWait},
+	}
+}
+
+// Load reads config/config.json, falling back to the defaults if it doesn't exist
+func Load() (*Config, error) {
+	return LoadFile(configFile)
+}
+
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Default(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if len(cfg.Profiles) == 0 {
+		cfg.Profiles = Default().Profiles
+	}
+	if cfg.ActiveProfile == "" {
+		cfg.ActiveProfile = cfg.Profiles[0].Name
+	}
+	if cfg.Favorites.ShuffleRatio == 0 {
+		cfg.Favorites.ShuffleRatio = defaultShuffleRatio
+	}
+	if cfg.Favorites.ShuffleRatio < 0 || cfg.Favorites.ShuffleRatio > 1 {
+		return nil, fmt.Errorf("favorites.shuffle_ratio must be between 0 and 1, got %v", cfg.Favorites.ShuffleRatio)
+	}
+	if cfg.Scan.Seconds == 0 {
+		cfg.Scan.Seconds = defaultScanSeconds
+	}
+	if cfg.Scan.WaitSeconds == 0 {
+		cfg.Scan.WaitSeconds = defaultScanWait
+	}
+	if cfg.Scan.Seconds < 0 || cfg.Scan.WaitSeconds < 0 {
+		return nil, fmt.Errorf("scan.seconds and scan.wait_seconds can't be negative, got %v and %v", cfg.Scan.Seconds, cfg.Scan.WaitSeconds)
+	}
+	if _, ok := cfg.Profile(cfg.ActiveProfile); !ok {
+		return nil, fmt.Errorf("active profile %q is not defined in %s", cfg.ActiveProfile, path)
+	}
+	return cfg, nil
+}
+
+// Profile looks up a filter profile by name (case-insensitive)
+func (c *Config) Profile(name string) (*api.FilterProfile, bool) {
+	for i := range c.Profiles {
+		if strings.EqualFold(c.Profiles[i].Name, name) {
+			return &c.Profiles[i], true
+		}
+	}
+	return nil, false
+}
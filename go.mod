@@ -3,7 +3,8 @@ module cli-radio
 go 1.21.5
 
 require (
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/lithammer/fuzzysearch v1.1.8 // indirect
-	golang.org/x/text v0.9.0 // indirect
+	github.com/joho/godotenv v1.5.1
+	github.com/lithammer/fuzzysearch v1.1.8
 )
+
+require golang.org/x/text v0.9.0
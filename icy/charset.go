@@ -0,0 +1,238 @@
+package icy
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// Hint is what we know about a station that helps guess which legacy charset it uses
+type Hint struct {
+	CountryCode string
+	Languages   []string
+}
+
+// how much better a repair has to look than the original before we use it
+const repairMargin = 2
+
+var (
+	cyrillicCharsets = []encoding.Encoding{charmap.Windows1251, charmap.KOI8R}
+	japaneseCharsets = []encoding.Encoding{japanese.ShiftJIS}
+	centralCharsets  = []encoding.Encoding{charmap.Windows1250}
+
+	// tried for every station, in this order
+	fallbackCharsets = []encoding.Encoding{charmap.Windows1252, charmap.Windows1251, japanese.ShiftJIS}
+
+	// charsets a decoder upstream (mpv, ffplay) may have wrongly assumed before handing us UTF-8
+	wrongCharsets = []encoding.Encoding{charmap.Windows1252, charmap.ISO8859_1}
+
+	countryCharsets = map[string][]encoding.Encoding{
+		"RU": cyrillicCharsets, "UA": cyrillicCharsets, "BY": cyrillicCharsets, "BG": cyrillicCharsets,
+		"RS": cyrillicCharsets, "MK": cyrillicCharsets, "KZ": cyrillicCharsets, "KG": cyrillicCharsets,
+		"JP": japaneseCharsets,
+		"PL": centralCharsets, "CZ": centralCharsets, "SK": centralCharsets, "HU": centralCharsets,
+		"HR": centralCharsets, "SI": centralCharsets, "RO": centralCharsets,
+	}
+	languageCharsets = map[string][]encoding.Encoding{
+		"russian": cyrillicCharsets, "ukrainian": cyrillicCharsets, "belarusian": cyrillicCharsets,
+		"bulgarian": cyrillicCharsets, "serbian": cyrillicCharsets, "macedonian": cyrillicCharsets,
+		"kazakh":   cyrillicCharsets,
+		"japanese": japaneseCharsets,
+		"polish":   centralCharsets, "czech": centralCharsets, "slovak": centralCharsets,
+		"hungarian": centralCharsets, "croatian": centralCharsets, "slovenian": centralCharsets,
+		"romanian": centralCharsets,
+	}
+)
+
+// charsets lists the encodings to try, the ones the hint points at first
+func (h Hint) charsets() []encoding.Encoding {
+	var list []encoding.Encoding
+	add := func(encs []encoding.Encoding) {
+		for _, e := range encs {
+			if !containsEncoding(list, e) {
+				list = append(list, e)
+			}
+		}
+	}
+	add(countryCharsets[strings.ToUpper(h.CountryCode)])
+	for _, lang := range h.Languages {
+		add(languageCharsets[strings.ToLower(strings.TrimSpace(lang))])
+	}
+	add(fallbackCharsets)
+	return list
+}
+
+// script is the writing system the hint says titles are likely in, nil for latin
+func (h Hint) script() *unicode.RangeTable {
+	encs := countryCharsets[strings.ToUpper(h.CountryCode)]
+	for _, lang := range h.Languages {
+		if encs == nil {
+			encs = languageCharsets[strings.ToLower(strings.TrimSpace(lang))]
+		}
+	}
+	switch {
+	case len(encs) == 0:
+		return nil
+	case encs[0] == cyrillicCharsets[0]:
+		return unicode.Cyrillic
+	case encs[0] == japaneseCharsets[0]:
+		return unicode.Han
+	}
+	return nil
+}
+
+// Repair fixes titles that arrive in a legacy charset or that were decoded with the
+// wrong one on the way (mojibake like "BjÃ¶rk"). Titles that look fine are returned as is.
+func Repair(title string, hint Hint) string {
+	if isASCII(title) {
+		return title
+	}
+
+	if !utf8.ValidString(title) {
+		// raw legacy bytes, keep whichever decoding reads best
+		best, bestScore := strings.ToValidUTF8(title, "�"), -1e9
+		for _, e := range hint.charsets() {
+			decoded, err := e.NewDecoder().String(title)
+			if err != nil {
+				continue
+			}
+			if score := plausibility(decoded, hint); score > bestScore {
+				best, bestScore = decoded, score
+			}
+		}
+		return best
+	}
+
+	// valid UTF-8 can still be legacy bytes that something decoded as Latin-1
+	if !hasLatin1(title) {
+		return title
+	}
+	best, bestScore := title, plausibility(title, hint)+repairMargin
+	for _, wrong := range wrongCharsets {
+		raw, err := wrong.NewEncoder().String(title)
+		if err != nil {
+			continue
+		}
+		if utf8.ValidString(raw) {
+			// UTF-8 read as Latin-1. Legacy text almost never happens to be valid UTF-8 too,
+			// so there's nothing to weigh this against.
+			return raw
+		}
+		var candidates []string
+		for _, e := range hint.charsets() {
+			if e == wrong || e == charmap.Windows1252 {
+				continue
+			}
+			if decoded, err := e.NewDecoder().String(raw); err == nil {
+				candidates = append(candidates, decoded)
+			}
+		}
+		for _, c := range candidates {
+			if score := plausibility(c, hint); score > bestScore {
+				best, bestScore = c, score
+			}
+		}
+	}
+	return best
+}
+
+// plausibility scores how much s looks like text a person wrote. Letters and plain
+// punctuation count up; replacement characters, control codes, stray Latin-1 symbols,
+// half-width katakana and words mixing scripts count down.
+func plausibility(s string, hint Hint) float64 {
+	want := hint.script()
+	score := 0.0
+	var prev rune
+	var prevScript *unicode.RangeTable
+	for _, r := range s {
+		script := scriptOf(r)
+		switch {
+		case r == utf8.RuneError:
+			score -= 4
+		case r < 0x20 || r >= 0x7f && r < 0xa0:
+			score -= 4
+		case r < 0x7f:
+			score++
+		case r < 0xc0:
+			// Latin-1 symbols: ¤ ¦ ¨ ± ² ¶ ... are rare in song titles
+			score--
+		case r >= 0xff61 && r <= 0xff9f:
+			// half-width katakana is what Latin-1 bytes turn into under Shift-JIS
+			score -= 2
+		case unicode.IsLetter(r):
+			score++
+			if want != nil && script == want {
+				score += 0.5
+			} else if want != nil && script == unicode.Latin && r >= 0x80 {
+				score -= 1.5
+			}
+		}
+
+		// two accented Latin-1 letters in a row is how UTF-8 and Cyrillic look when read as Latin-1
+		if isLatin1Letter(prev) && r >= 0x80 && r <= 0xff {
+			score -= 2
+		}
+		if prevScript != nil && script != nil && prevScript != script && unicode.IsLetter(prev) && unicode.IsLetter(r) {
+			score -= 3
+		}
+		// "кИНО": case flipping mid-word is a sign of the wrong Cyrillic table
+		if unicode.IsLower(prev) && unicode.IsUpper(r) && r >= 0x80 {
+			score--
+		}
+		prev, prevScript = r, script
+	}
+	return score
+}
+
+var scripts = []*unicode.RangeTable{unicode.Latin, unicode.Cyrillic, unicode.Greek, unicode.Han, unicode.Arabic, unicode.Hebrew, unicode.Hangul}
+
+// scriptOf groups a letter by writing system, counting kana as Han so Japanese isn't "mixed"
+func scriptOf(r rune) *unicode.RangeTable {
+	if !unicode.IsLetter(r) {
+		return nil
+	}
+	if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+		return unicode.Han
+	}
+	for _, s := range scripts {
+		if unicode.Is(s, r) {
+			return s
+		}
+	}
+	return nil
+}
+
+func isLatin1Letter(r rune) bool {
+	return r >= 0xc0 && r <= 0xff
+}
+
+func hasLatin1(s string) bool {
+	for _, r := range s {
+		if r >= 0x80 && r <= 0xff {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func containsEncoding(list []encoding.Encoding, e encoding.Encoding) bool {
+	for _, l := range list {
+		if l == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package icy
+
+import (
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// legacy turns a title into the bytes a station using e would send
+func legacy(t *testing.T, e encoding.Encoding, s string) string {
+	t.Helper()
+	out, err := e.NewEncoder().String(s)
+	if err != nil {
+		t.Fatalf("encode %q: %v", s, err)
+	}
+	return out
+}
+
+// misread is what s looks like after a player decoded its bytes with the wrong charset
+func misread(t *testing.T, e encoding.Encoding, s string) string {
+	t.Helper()
+	out, err := e.NewDecoder().String(s)
+	if err != nil {
+		t.Fatalf("decode %q: %v", s, err)
+	}
+	return out
+}
+
+func TestRepair(t *testing.T) {
+	ru := Hint{CountryCode: "RU", Languages: []string{"russian"}}
+	jp := Hint{CountryCode: "JP", Languages: []string{"japanese"}}
+	fr := Hint{CountryCode: "FR", Languages: []string{"french"}}
+	latin1, cp1251, sjis := charmap.Windows1252, charmap.Windows1251, japanese.ShiftJIS
+
+	tests := []struct {
+		name  string
+		title string
+		hint  Hint
+		want  string
+	}{
+		{"ascii", "Nina Simone - Sinnerman", Hint{}, "Nina Simone - Sinnerman"},
+		{"good utf-8", "Björk - Jóga", Hint{}, "Björk - Jóga"},
+		{"good french", "Édith Piaf - Non, je ne regrette rien", fr, "Édith Piaf - Non, je ne regrette rien"},
+		{"good doubled accents", "Cesária Évora - Crêuza", Hint{}, "Cesária Évora - Crêuza"},
+		{"good cyrillic", "Кино - Группа крови", ru, "Кино - Группа крови"},
+		{"good japanese", "宇多田ヒカル - First Love", jp, "宇多田ヒカル - First Love"},
+		{"good with symbols", "Beyoncé - Halo © 2008", Hint{}, "Beyoncé - Halo © 2008"},
+
+		{"raw latin-1", legacy(t, latin1, "Björk - Jóga"), Hint{}, "Björk - Jóga"},
+		{"raw latin-1 with hint", legacy(t, latin1, "Édith Piaf - Milord"), fr, "Édith Piaf - Milord"},
+		{"raw cp1251", legacy(t, cp1251, "Кино - Группа крови"), Hint{}, "Кино - Группа крови"},
+		{"raw cp1251 with hint", legacy(t, cp1251, "Сплин - Выхода нет"), ru, "Сплин - Выхода нет"},
+		{"raw koi8-r", legacy(t, charmap.KOI8R, "Сплин - Выхода нет"), ru, "Сплин - Выхода нет"},
+		{"raw shift-jis", legacy(t, sjis, "宇多田ヒカル - 初恋"), Hint{}, "宇多田ヒカル - 初恋"},
+		{"raw shift-jis with hint", legacy(t, sjis, "椎名林檎 - 丸の内サディスティック"), jp, "椎名林檎 - 丸の内サディスティック"},
+
+		{"utf-8 read as latin-1", misread(t, latin1, "Björk - Jóga"), Hint{}, "Björk - Jóga"},
+		{"utf-8 cyrillic read as latin-1", misread(t, latin1, "Кино - Кукушка"), Hint{}, "Кино - Кукушка"},
+		{"utf-8 read as iso-8859-1", misread(t, charmap.ISO8859_1, "Кино - Кукушка"), Hint{}, "Кино - Кукушка"},
+		{"cp1251 read as latin-1", misread(t, latin1, legacy(t, cp1251, "Кино - Группа крови")), ru, "Кино - Группа крови"},
+		{"cp1251 read as latin-1 no hint", misread(t, latin1, legacy(t, cp1251, "Кино - Группа крови")), Hint{}, "Кино - Группа крови"},
+		{"shift-jis read as latin-1", misread(t, charmap.ISO8859_1, legacy(t, sjis, "宇多田ヒカル - 初恋")), jp, "宇多田ヒカル - 初恋"},
+	}
+	for _, tt := range tests {
+		if got := Repair(tt.title, tt.hint); got != tt.want {
+			t.Errorf("%s: Repair(%q) = %q, want %q", tt.name, tt.title, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package icy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers are the station details an Icecast/SHOUTcast server sends with the stream
+type Headers struct {
+	Name        string
+	Genre       string
+	Description string
+	URL         string
+	Bitrate     int
+	MetaInt     int // audio bytes between metadata blocks, 0 if the server sends none
+	ContentType string
+}
+
+func parseHeaders(h http.Header) Headers {
+	bitrate, _ := strconv.Atoi(strings.SplitN(h.Get("icy-br"), ",", 2)[0])
+	metaint, _ := strconv.Atoi(h.Get("icy-metaint"))
+	return Headers{
+		Name:        h.Get("icy-name"),
+		Genre:       h.Get("icy-genre"),
+		Description: h.Get("icy-description"),
+		URL:         h.Get("icy-url"),
+		Bitrate:     bitrate,
+		MetaInt:     metaint,
+		ContentType: h.Get("Content-Type"),
+	}
+}
+
+// Reader strips interleaved metadata out of a stream body, so Read only ever returns audio
+type Reader struct {
+	r         *bufio.Reader
+	metaint   int
+	remaining int // audio bytes left before the next metadata block
+	onMeta    func(Metadata)
+}
+
+// NewReader wraps a stream body. With metaint 0 the body is passed through untouched.
+func NewReader(r io.Reader, metaint int, onMeta func(Metadata)) *Reader {
+	return &Reader{r: bufio.NewReader(r), metaint: metaint, remaining: metaint, onMeta: onMeta}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.metaint == 0 {
+		return r.r.Read(p)
+	}
+	if r.remaining == 0 {
+		if err := r.readMetadata(); err != nil {
+			return 0, err
+		}
+		r.remaining = r.metaint
+	}
+	if len(p) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.r.Read(p)
+	r.remaining -= n
+	return n, err
+}
+
+// readMetadata reads one block: a length byte (in 16 byte units) followed by the text
+func (r *Reader) readMetadata() error {
+	length, err := r.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if length == 0 {
+		// the server only sends a block when something changed
+		return nil
+	}
+	block := make([]byte, int(length)*16)
+	if _, err := io.ReadFull(r.r, block); err != nil {
+		return fmt.Errorf("truncated metadata block: %w", err)
+	}
+	if r.onMeta != nil {
+		r.onMeta(ParseMetadata(block))
+	}
+	return nil
+}
+
+// Stream is an open connection to a radio stream
+type Stream struct {
+	Headers Headers
+	// Body yields audio only
+	Body *Reader
+	resp *http.Response
+}
+
+func (s *Stream) Close() error {
+	return s.resp.Body.Close()
+}
+
+// how long a station gets to answer once connected. Streams never end, so there's no
+// overall deadline, but one that takes our connection and never answers would hold up
+// whoever is waiting to play it.
+var headerTimeout = 10 * time.Second
+
+// NewClient returns an http.Client that also understands SHOUTcast v1 servers,
+// which answer with "ICY 200 OK" instead of an HTTP status line
+func NewClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = headerTimeout
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &shoutcastConn{Conn: conn}, nil
+	}
+	return &http.Client{Transport: transport}
+}
+
+// Open requests the stream with Icy-MetaData: 1 and returns it with headers parsed.
+// onMeta is called from Body.Read for every metadata block.
+func Open(ctx context.Context, client *http.Client, url string, onMeta func(Metadata)) (*Stream, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Icy-MetaData", "1")
+	req.Header.Set("User-Agent", "cli-radio/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("stream request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("stream request failed with status %d", resp.StatusCode)
+	}
+
+	headers := parseHeaders(resp.Header)
+	return &Stream{
+		Headers: headers,
+		Body:    NewReader(resp.Body, headers.MetaInt, onMeta),
+		resp:    resp,
+	}, nil
+}
+
+// Watch reads a stream, throwing the audio away, and reports every title change until
+// ctx is cancelled or the stream ends. It can run next to a player or on its own.
+func Watch(ctx context.Context, client *http.Client, url string, onHeaders func(Headers), onTitle func(Metadata)) error {
+	var last string
+	stream, err := Open(ctx, client, url, func(m Metadata) {
+		if m.StreamTitle != last {
+			last = m.StreamTitle
+			onTitle(m)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	if onHeaders != nil {
+		onHeaders(stream.Headers)
+	}
+	if stream.Headers.MetaInt == 0 {
+		return fmt.Errorf("server doesn't send ICY metadata")
+	}
+	_, err = io.Copy(io.Discard, stream.Body)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// shoutcastConn rewrites a leading "ICY" status line to "HTTP/1.0" so net/http can parse it
+type shoutcastConn struct {
+	net.Conn
+	checked bool
+	pending []byte // rewritten bytes that didn't fit in the caller's buffer
+}
+
+func (c *shoutcastConn) Read(p []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	n, err := c.Conn.Read(p)
+	if !c.checked && n > 0 {
+		c.checked = true
+		if n >= 4 && string(p[:4]) == "ICY " {
+			fixed := append([]byte("HTTP/1.0"), p[3:n]...)
+			n = copy(p, fixed)
+			c.pending = fixed[n:]
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,190 @@
+package icy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeIcecast serves audio of repeating bytes with a metadata block every metaint bytes
+type fakeIcecast struct {
+	metaint int
+	titles  []string // one per block, "" sends an empty (length 0) block
+	audio   []byte   // everything written as audio, for comparison
+}
+
+func (f *fakeIcecast) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("icy-name", "Fake FM")
+	w.Header().Set("icy-genre", "Jazz")
+	w.Header().Set("icy-br", "128")
+	wantMeta := r.Header.Get("Icy-MetaData") == "1"
+	if wantMeta {
+		w.Header().Set("icy-metaint", fmt.Sprint(f.metaint))
+	}
+
+	for i, title := range f.titles {
+		chunk := bytes.Repeat([]byte{byte('a' + i%26)}, f.metaint)
+		f.audio = append(f.audio, chunk...)
+		w.Write(chunk)
+		if wantMeta {
+			w.Write(metadataBlock(title))
+		}
+	}
+}
+
+func metadataBlock(title string) []byte {
+	if title == "" {
+		return []byte{0}
+	}
+	text := fmt.Sprintf("StreamTitle='%s';StreamUrl='http://fake.fm/now';", title)
+	blocks := (len(text) + 15) / 16
+	padded := make([]byte, blocks*16)
+	copy(padded, text)
+	return append([]byte{byte(blocks)}, padded...)
+}
+
+func TestOpenStripsMetadata(t *testing.T) {
+	fake := &fakeIcecast{metaint: 100, titles: []string{"Nina Simone - Sinnerman", "", "Tom Jobim - Wave"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	var titles []string
+	stream, err := Open(context.Background(), NewClient(), server.URL, func(m Metadata) {
+		titles = append(titles, m.StreamTitle)
+		if m.StreamURL != "http://fake.fm/now" {
+			t.Errorf("StreamURL = %q", m.StreamURL)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer stream.Close()
+
+	if h := stream.Headers; h.Name != "Fake FM" || h.Genre != "Jazz" || h.Bitrate != 128 || h.MetaInt != 100 {
+		t.Errorf("headers = %+v", h)
+	}
+	audio, err := io.ReadAll(stream.Body)
+	if err != nil {
+		t.Fatalf("reading stream failed: %v", err)
+	}
+	if !bytes.Equal(audio, fake.audio) {
+		t.Errorf("audio has %d bytes, want %d clean bytes", len(audio), len(fake.audio))
+	}
+	if strings.Join(titles, "|") != "Nina Simone - Sinnerman|Tom Jobim - Wave" {
+		t.Errorf("titles = %q", titles)
+	}
+}
+
+func TestWatchReportsChanges(t *testing.T) {
+	fake := &fakeIcecast{metaint: 64, titles: []string{"A - One", "A - One", "B - Two"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	var headers Headers
+	var titles []string
+	err := Watch(context.Background(), NewClient(), server.URL,
+		func(h Headers) { headers = h },
+		func(m Metadata) { titles = append(titles, m.StreamTitle) })
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if headers.Name != "Fake FM" || len(titles) != 2 || titles[1] != "B - Two" {
+		t.Errorf("headers = %+v, titles = %q", headers, titles)
+	}
+}
+
+func TestOpenGivesUpWithoutHeaders(t *testing.T) {
+	// takes the connection and never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	defer func(old time.Duration) { headerTimeout = old }(headerTimeout)
+	headerTimeout = 100 * time.Millisecond
+	opened := make(chan error, 1)
+	go func() {
+		_, err := Open(context.Background(), NewClient(), "http://"+listener.Addr().String(), nil)
+		opened <- err
+	}()
+	select {
+	case err := <-opened:
+		if err == nil {
+			t.Error("Open succeeded without any headers")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Open is still waiting for headers")
+	}
+}
+
+func TestShoutcastV1StatusLine(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		io.ReadAll(io.LimitReader(conn, 1)) // wait for the request to start
+		fmt.Fprint(conn, "ICY 200 OK\r\nicy-name:Old School FM\r\nicy-metaint:8\r\n\r\n")
+		conn.Write([]byte("12345678"))
+		conn.Write(metadataBlock("Old - Song"))
+		conn.Write([]byte("abcdefgh"))
+	}()
+
+	var title string
+	stream, err := Open(context.Background(), NewClient(), "http://"+listener.Addr().String()+"/", func(m Metadata) { title = m.StreamTitle })
+	if err != nil {
+		t.Fatalf("Open failed on an ICY status line: %v", err)
+	}
+	defer stream.Close()
+	audio, _ := io.ReadAll(stream.Body)
+	if stream.Headers.Name != "Old School FM" || string(audio) != "12345678abcdefgh" || title != "Old - Song" {
+		t.Errorf("headers = %+v, audio = %q, title = %q", stream.Headers, audio, title)
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		block string
+		title string
+		url   string
+	}{
+		{"StreamTitle='Artist - Title';", "Artist - Title", ""},
+		{"StreamTitle='Artist - Title';StreamUrl='http://x.y/z';\x00\x00\x00", "Artist - Title", "http://x.y/z"},
+		{"StreamTitle='Guns N' Roses - Sweet Child O' Mine';StreamUrl='';", "Guns N' Roses - Sweet Child O' Mine", ""},
+		{"StreamTitle='Who's there?;Nobody';StreamUrl='';", "Who's there?;Nobody", ""},
+		{"StreamTitle='';", "", ""},
+		{"StreamTitle='No terminator", "No terminator", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		m := ParseMetadata([]byte(tt.block))
+		if m.StreamTitle != tt.title || m.StreamURL != tt.url {
+			t.Errorf("ParseMetadata(%q) = %q, %q; want %q, %q", tt.block, m.StreamTitle, m.StreamURL, tt.title, tt.url)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package icy
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Metadata is one decoded metadata block from the stream
+type Metadata struct {
+	StreamTitle string
+	StreamURL   string
+	// Fields holds every key in the block, including the two above
+	Fields map[string]string
+}
+
+// ParseMetadata decodes a block like `StreamTitle='Artist - Title';StreamUrl='';`.
+// Titles can contain quotes and semicolons themselves, so a value only ends at a `';`
+// that is followed by another key or the end of the block.
+func ParseMetadata(block []byte) Metadata {
+	s := string(bytes.TrimRight(block, "\x00"))
+	m := Metadata{Fields: map[string]string{}}
+
+	for len(s) > 0 {
+		eq := strings.Index(s, "='")
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		rest := s[eq+2:]
+
+		end := valueEnd(rest)
+		value := rest[:end]
+		s = strings.TrimPrefix(rest[end:], "'")
+		s = strings.TrimPrefix(s, ";")
+
+		m.Fields[key] = value
+		switch strings.ToLower(key) {
+		case "streamtitle":
+			m.StreamTitle = strings.TrimSpace(value)
+		case "streamurl":
+			m.StreamURL = strings.TrimSpace(value)
+		}
+	}
+	return m
+}
+
+// valueEnd finds where a quoted value stops in s (which starts just after the opening quote)
+func valueEnd(s string) int {
+	offset := 0
+	for {
+		i := strings.Index(s[offset:], "';")
+		if i < 0 {
+			// no terminator, take everything up to a closing quote if there is one
+			return len(strings.TrimSuffix(s, "'"))
+		}
+		end := offset + i
+		next := s[end+2:]
+		if next == "" || looksLikeKey(next) {
+			return end
+		}
+		offset = end + 2
+	}
+}
+
+// looksLikeKey reports whether s starts with `Word='`
+func looksLikeKey(s string) bool {
+	eq := strings.Index(s, "='")
+	if eq <= 0 {
+		return false
+	}
+	for _, r := range s[:eq] {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
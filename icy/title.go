@@ -0,0 +1,302 @@
+package icy
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type TitleKind int
+
+const (
+	// Song is a real track we can look up
+	Song TitleKind = iota
+	// Placeholder is an empty or dummy title ("", "-", "Unknown")
+	Placeholder
+	// Ad marks commercial breaks
+	Ad
+	// Slogan is the station talking about itself: names, jingles, urls
+	Slogan
+)
+
+func (k TitleKind) String() string {
+	switch k {
+	case Song:
+		return "song"
+	case Placeholder:
+		return "placeholder"
+	case Ad:
+		return "ad"
+	case Slogan:
+		return "slogan"
+	}
+	return "unknown"
+}
+
+// Title is a stream title split into its parts
+type Title struct {
+	Raw    string
+	Kind   TitleKind
+	Artist string
+	Title  string
+	Album  string
+	// Extras are version notes and featured artists, e.g. "Radio Edit", "feat. Drake"
+	Extras []string
+}
+
+func (t Title) IsSong() bool {
+	return t.Kind == Song
+}
+
+// String gives the cleaned up "Artist - Title"
+func (t Title) String() string {
+	if t.Kind != Song {
+		return t.Raw
+	}
+	if t.Artist == "" {
+		return t.Title
+	}
+	return t.Artist + " - " + t.Title
+}
+
+// Query is what to search for on Spotify: artist and title without the noise
+func (t Title) Query() string {
+	return strings.TrimSpace(t.Artist + " " + t.Title)
+}
+
+var (
+	// placeholders are dummy titles, checked against the whole title
+	placeholders = map[string]bool{
+		"": true, "-": true, "--": true, "?": true, "...": true, "n/a": true, "na": true, "null": true, "none": true,
+		"unknown": true, "unknown - unknown": true, "untitled": true, "no title": true, "no name": true,
+		"song unavailable": true, "artist - title": true, "stream": true, "live": true, "live stream": true,
+		"advert:": true, "title": true,
+	}
+
+	// unknownParts mean nothing on either side of "Artist - Title". Words like "live" and
+	// "stream" only count as a whole title, there are bands called that.
+	unknownParts = map[string]bool{
+		"": true, "-": true, "--": true, "?": true, "...": true, "n/a": true, "na": true, "null": true, "none": true,
+		"unknown": true, "untitled": true, "no title": true, "no name": true,
+	}
+
+	adPattern = regexp.MustCompile(`(?i)(\bads?\b.*\bbreak\b|\bad ?break|\badvert|\bcommercials? ?(break|block|spot)s?\b|^\s*commercials?\s*$|\bsponsor|\bspot ?block\b|\bwerbung\b|\bpublicidad\b|\bpublicité\b|\bpubblicità\b|\breklam|^\s*promos?\s*$|\bpromo ?(break|block|spot)s?\b|\bstreamads\b|adswizz|triton ?digital|\bpreroll\b|^\s*ad\s*$|^\s*spot\s*$|text\s+\w+\s+to\s+\d{3,})`)
+
+	// stations bragging about having no ads
+	adFreePattern = regexp.MustCompile(`(?i)\b(commercial|ad|advert)s?[ -]free\b`)
+
+	sloganPattern = regexp.MustCompile(`(?i)(https?://|www\.|\.(com|net|org|fm|de|uk|fr|br|ru)\b|\b(you'?re|you are) (listening|tuned)|\bnow playing\b|\bon air\b|\bstation id\b|\bjingle\b|\b#?1 (for|hit|station)\b|\bthe best (of|music|hits|mix)\b|\b24/7\b|\bcall (us|now)\b|\brequest line\b|\bcommercial free\b|\bnon-?stop\b|\bhits? radio\b|\bradio\b.*\b(fm|online|station)\b|^\s*(\S+\s+)?(fm|radio)(\s+\S+)?\s*$)`)
+
+	// leading labels some stations put in front of the song
+	prefixPattern = regexp.MustCompile(`(?i)^\s*(now playing|now on air|on air|currently playing|playing|np|♪|♫)\s*[:\-–>|]*\s*`)
+
+	// trailing durations and timestamps, e.g. "(3:45)" or "[00:03:21]"
+	durationPattern = regexp.MustCompile(`\s*[\[(]?\b\d{1,2}:\d{2}(:\d{2})?\b[\])]?\s*$`)
+
+	featPattern = regexp.MustCompile(`(?i)\s+[\(\[]?\b(feat\.?|ft\.?|featuring|with)\s+([^\)\]]+)[\)\]]?`)
+
+	bracketPattern = regexp.MustCompile(`\s*([\(\[]([^\(\)\[\]]*)[\)\]])\s*$`)
+
+	versionPattern = regexp.MustCompile(`(?i)\b(edit|mix|remix|version|remaster(ed)?|live|acoustic|demo|mono|stereo|explicit|clean|instrumental|extended|original|radio|single|album|bonus|reprise|rework|dub|vip|bootleg|session|unplugged|cover|deluxe|\d{4})\b`)
+
+	yearPattern = regexp.MustCompile(`^\d{4}$`)
+
+	// what comes after "by" in titles like "Stand by Me" or "Stand by Your Man", rather than an artist
+	byObjectPattern = regexp.MustCompile(`(?i)^(me|you|your|my|him|her|his|us|our|them|their|it|myself|yourself)\b`)
+)
+
+// nobody tags a song with more notes than this, and it keeps garbage titles cheap
+const maxExtras = 8
+
+// separators between artist and title, most specific first. A bare "-" or "/" is
+// left alone so names like "Jay-Z" and "AC/DC" survive.
+var separators = []string{" - ", " – ", " — ", " -- ", " ~ ", " | ", " / ", " :: ", " · "}
+
+// ParseTitle splits a raw ICY StreamTitle into artist, title, album and extras
+func ParseTitle(raw string) Title {
+	t := Title{Raw: raw}
+	s := clean(raw)
+
+	lower := strings.ToLower(s)
+	if placeholders[lower] || !hasLetterOrDigit(s) {
+		t.Kind = Placeholder
+		return t
+	}
+	if adPattern.MatchString(s) && !adFreePattern.MatchString(s) {
+		t.Kind = Ad
+		return t
+	}
+
+	artist, title, rest, ok := split(s)
+	if !ok {
+		title, artist, ok = splitBy(s)
+	}
+	if !ok {
+		if sloganPattern.MatchString(s) {
+			t.Kind = Slogan
+			return t
+		}
+		// no separator at all, treat the whole thing as a title
+		title = s
+	}
+
+	artist, title = strings.TrimSpace(artist), strings.TrimSpace(title)
+	if ok && unknownParts[strings.ToLower(artist)] && unknownParts[strings.ToLower(title)] {
+		t.Kind = Placeholder
+		return t
+	}
+	if ok && sloganPattern.MatchString(s) && !looksLikeSong(artist, title) {
+		t.Kind = Slogan
+		return t
+	}
+
+	var extras []string
+	title, extras = takeExtras(title, extras)
+	artist, extras = takeFeaturing(artist, extras)
+
+	// a version note on the "artist" side means the station sent "Title - Artist"
+	if ok && hasVersion(artist) && !hasVersion(title) {
+		artist, title = title, artist
+		title, extras = takeExtras(title, extras)
+	}
+	artist, extras = takeExtras(artist, extras)
+
+	for _, part := range rest {
+		if versionPattern.MatchString(part) && len(strings.Fields(part)) <= 4 {
+			extras = append(extras, part)
+		} else if t.Album == "" {
+			t.Album = part
+		} else {
+			extras = append(extras, part)
+		}
+	}
+
+	if unknownParts[strings.ToLower(artist)] {
+		artist = ""
+	}
+	if unknownParts[strings.ToLower(title)] {
+		if artist == "" {
+			t.Kind = Placeholder
+			return t
+		}
+		title, artist = artist, ""
+	}
+
+	t.Kind = Song
+	t.Artist, t.Title, t.Extras = artist, title, extras
+	return t
+}
+
+// splitBy reads "Title by Artist", as long as what follows "by" looks like an artist
+// rather than the rest of a title like "Stand by Me" or "Day by Day"
+func splitBy(s string) (title, artist string, ok bool) {
+	i := strings.LastIndex(strings.ToLower(s), " by ")
+	if i <= 0 {
+		return "", "", false
+	}
+	title, artist = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+4:])
+	if artist == "" || byObjectPattern.MatchString(artist) || strings.EqualFold(title, artist) {
+		return "", "", false
+	}
+	return title, artist, true
+}
+
+// clean strips quotes, labels, durations and extra whitespace
+func clean(raw string) string {
+	s := strings.ToValidUTF8(raw, "")
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+	s = strings.Join(strings.Fields(s), " ")
+	s = prefixPattern.ReplaceAllString(s, "")
+	s = durationPattern.ReplaceAllString(s, "")
+	for len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '\'' && s[len(s)-1] == '\'') {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	return strings.Trim(s, " -–—|/")
+}
+
+// split cuts s on the first separator found, returning any further parts as rest
+func split(s string) (artist, title string, rest []string, ok bool) {
+	for _, sep := range separators {
+		if !strings.Contains(s, sep) {
+			continue
+		}
+		parts := strings.Split(s, sep)
+		var kept []string
+		for _, p := range parts {
+			if p = strings.TrimSpace(p); p != "" {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) < 2 {
+			return "", strings.Join(kept, ""), nil, false
+		}
+		return kept[0], kept[1], kept[2:], true
+	}
+	return "", "", nil, false
+}
+
+// takeExtras peels trailing bracketed notes like "(Radio Edit)" off s
+func takeExtras(s string, extras []string) (string, []string) {
+	s, extras = takeFeaturing(s, extras)
+	var found []string
+	for i := 0; i < maxExtras; i++ {
+		m := bracketPattern.FindStringSubmatchIndex(s)
+		if m == nil {
+			break
+		}
+		inner := strings.TrimSpace(s[m[4]:m[5]])
+		if inner != "" && !versionPattern.MatchString(inner) && !yearPattern.MatchString(inner) {
+			break
+		}
+		// a title that is nothing but brackets keeps them, "(I Can't Get No) Satisfaction" style
+		if strings.TrimSpace(s[:m[0]]) == "" {
+			break
+		}
+		if inner != "" {
+			found = append([]string{inner}, found...)
+		}
+		s = strings.TrimSpace(s[:m[0]])
+	}
+	return s, append(extras, found...)
+}
+
+// takeFeaturing moves "feat. X" into extras
+func takeFeaturing(s string, extras []string) (string, []string) {
+	m := featPattern.FindStringSubmatchIndex(s)
+	if m == nil {
+		return s, extras
+	}
+	word := strings.ToLower(strings.TrimSuffix(s[m[2]:m[3]], "."))
+	// "with" is too common in titles to trust unless it's in brackets
+	if word == "with" && !strings.ContainsAny(s[m[0]:m[2]], "([") {
+		return s, extras
+	}
+	names := strings.TrimSpace(s[m[4]:m[5]])
+	rest := strings.TrimSpace(s[:m[0]] + " " + s[m[1]:])
+	return rest, append(extras, "feat. "+names)
+}
+
+func hasVersion(s string) bool {
+	m := bracketPattern.FindStringSubmatch(s)
+	return m != nil && versionPattern.MatchString(m[2])
+}
+
+// looksLikeSong lets real tracks through that happen to mention "radio" or a url,
+// like "Radiohead - Creep" or "Queen - Radio Ga Ga"
+func looksLikeSong(artist, title string) bool {
+	return artist != "" && title != "" && !sloganPattern.MatchString(artist) && !sloganPattern.MatchString(title)
+}
+
+func hasLetterOrDigit(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
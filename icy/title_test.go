@@ -0,0 +1,226 @@
+package icy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// titles as they show up on real stations
+var titleCorpus = []struct {
+	raw    string
+	kind   TitleKind
+	artist string
+	title  string
+	album  string
+	extras []string
+}{
+	// plain separators
+	{raw: "Nina Simone - Sinnerman", artist: "Nina Simone", title: "Sinnerman"},
+	{raw: "Daft Punk – One More Time", artist: "Daft Punk", title: "One More Time"},
+	{raw: "Sade — Smooth Operator", artist: "Sade", title: "Smooth Operator"},
+	{raw: "Miles Davis / So What", artist: "Miles Davis", title: "So What"},
+	{raw: "Boards of Canada | Roygbiv", artist: "Boards of Canada", title: "Roygbiv"},
+	{raw: "Cesária Évora -- Sodade", artist: "Cesária Évora", title: "Sodade"},
+	{raw: "  Massive Attack   -   Teardrop  ", artist: "Massive Attack", title: "Teardrop"},
+	{raw: "'Portishead - Glory Box'", artist: "Portishead", title: "Glory Box"},
+	{raw: `"Björk - Jóga"`, artist: "Björk", title: "Jóga"},
+	{raw: "宇多田ヒカル - First Love", artist: "宇多田ヒカル", title: "First Love"},
+	{raw: "Кино - Группа крови", artist: "Кино", title: "Группа крови"},
+	{raw: "Tom Jobim - Águas de Março", artist: "Tom Jobim", title: "Águas de Março"},
+
+	// hyphens and slashes inside names aren't separators
+	{raw: "AC/DC - Back In Black", artist: "AC/DC", title: "Back In Black"},
+	{raw: "Jay-Z - 99 Problems", artist: "Jay-Z", title: "99 Problems"},
+	{raw: "a-ha - Take On Me", artist: "a-ha", title: "Take On Me"},
+	{raw: "Sly & The Family Stone - Everyday People", artist: "Sly & The Family Stone", title: "Everyday People"},
+	{raw: "Earth, Wind & Fire - September", artist: "Earth, Wind & Fire", title: "September"},
+	{raw: "Blink-182 - All The Small Things", artist: "Blink-182", title: "All The Small Things"},
+
+	// bands named like placeholders
+	{raw: "Live - Lightning Crashes", artist: "Live", title: "Lightning Crashes"},
+
+	// "by" and reversed order
+	{raw: "Sinnerman by Nina Simone", artist: "Nina Simone", title: "Sinnerman"},
+	{raw: "Stand By Me by Ben E. King", artist: "Ben E. King", title: "Stand By Me"},
+	{raw: "Killing Me Softly by the Fugees", artist: "the Fugees", title: "Killing Me Softly"},
+	{raw: "Stand by Me", title: "Stand by Me"},
+	{raw: "Stand by Your Man", title: "Stand by Your Man"},
+	{raw: "Day by Day", title: "Day by Day"},
+	{raw: "Bohemian Rhapsody (Remastered 2011) - Queen", artist: "Queen", title: "Bohemian Rhapsody", extras: []string{"Remastered 2011"}},
+	{raw: "Blue Monday (Radio Edit) - New Order", artist: "New Order", title: "Blue Monday", extras: []string{"Radio Edit"}},
+
+	// featured artists
+	{raw: "Rihanna feat. Drake - Work", artist: "Rihanna", title: "Work", extras: []string{"feat. Drake"}},
+	{raw: "Daft Punk ft. Pharrell Williams - Get Lucky", artist: "Daft Punk", title: "Get Lucky", extras: []string{"feat. Pharrell Williams"}},
+	{raw: "Gorillaz - Feel Good Inc. (feat. De La Soul)", artist: "Gorillaz", title: "Feel Good Inc.", extras: []string{"feat. De La Soul"}},
+	{raw: "Calvin Harris - Summer [ft. Example]", artist: "Calvin Harris", title: "Summer", extras: []string{"feat. Example"}},
+	{raw: "Santana featuring Rob Thomas - Smooth", artist: "Santana", title: "Smooth", extras: []string{"feat. Rob Thomas"}},
+	{raw: "Eminem - Stan (with Dido)", artist: "Eminem", title: "Stan", extras: []string{"feat. Dido"}},
+	{raw: "Bobby Brown - Every Little Step With You", artist: "Bobby Brown", title: "Every Little Step With You"},
+	{raw: "Tiësto Feat. Nelly Furtado - Who Wants To Be Alone", artist: "Tiësto", title: "Who Wants To Be Alone", extras: []string{"feat. Nelly Furtado"}},
+
+	// bracketed extras
+	{raw: "New Order - Blue Monday (Radio Edit)", artist: "New Order", title: "Blue Monday", extras: []string{"Radio Edit"}},
+	{raw: "Queen - Bohemian Rhapsody (Remastered 2011)", artist: "Queen", title: "Bohemian Rhapsody", extras: []string{"Remastered 2011"}},
+	{raw: "Eric Prydz - Opus (Original Mix) [Explicit]", artist: "Eric Prydz", title: "Opus", extras: []string{"Original Mix", "Explicit"}},
+	{raw: "Nirvana - Come As You Are (Live)", artist: "Nirvana", title: "Come As You Are", extras: []string{"Live"}},
+	{raw: "Pink Floyd - Time [1973]", artist: "Pink Floyd", title: "Time", extras: []string{"1973"}},
+	{raw: "The Rolling Stones - (I Can't Get No) Satisfaction", artist: "The Rolling Stones", title: "(I Can't Get No) Satisfaction"},
+	{raw: "Simon & Garfunkel - The Boxer (Part 1)", artist: "Simon & Garfunkel", title: "The Boxer (Part 1)"},
+	{raw: "Oasis - Wonderwall - Remastered", artist: "Oasis", title: "Wonderwall", extras: []string{"Remastered"}},
+	{raw: "Prince - Purple Rain ()", artist: "Prince", title: "Purple Rain"},
+
+	// albums
+	{raw: "Radiohead - Airbag - OK Computer", artist: "Radiohead", title: "Airbag", album: "OK Computer"},
+	{raw: "Miles Davis - Blue in Green - Kind of Blue - 1959 Remaster", artist: "Miles Davis", title: "Blue in Green", album: "Kind of Blue", extras: []string{"1959 Remaster"}},
+
+	// noise around the song
+	{raw: "Now Playing: Fleetwood Mac - Dreams", artist: "Fleetwood Mac", title: "Dreams"},
+	{raw: "On Air: Kate Bush - Running Up That Hill", artist: "Kate Bush", title: "Running Up That Hill"},
+	{raw: "Talking Heads - Once in a Lifetime (4:19)", artist: "Talking Heads", title: "Once in a Lifetime"},
+	{raw: "The Cure - Lovesong [00:03:29]", artist: "The Cure", title: "Lovesong"},
+	{raw: "Joy Division - Atmosphere\x00\x00", artist: "Joy Division", title: "Atmosphere"},
+	{raw: "- Bicep - Glue -", artist: "Bicep", title: "Glue"},
+
+	// names that look like station talk but are songs
+	{raw: "Radiohead - Creep", artist: "Radiohead", title: "Creep"},
+	{raw: "Queen - Radio Ga Ga", artist: "Queen", title: "Radio Ga Ga"},
+	{raw: "The Buggles - Video Killed the Radio Star", artist: "The Buggles", title: "Video Killed the Radio Star"},
+
+	// only one part
+	{raw: "Sinnerman", title: "Sinnerman"},
+	{raw: "Unknown - Sinnerman", title: "Sinnerman"},
+	{raw: "Nina Simone - Unknown", title: "Nina Simone"},
+
+	// placeholders
+	{raw: "", kind: Placeholder},
+	{raw: "   ", kind: Placeholder},
+	{raw: "-", kind: Placeholder},
+	{raw: " - ", kind: Placeholder},
+	{raw: "...", kind: Placeholder},
+	{raw: "Unknown", kind: Placeholder},
+	{raw: "Unknown - Unknown", kind: Placeholder},
+	{raw: "unknown – unknown", kind: Placeholder},
+	{raw: "Song unavailable", kind: Placeholder},
+	{raw: "N/A", kind: Placeholder},
+	{raw: "null", kind: Placeholder},
+	{raw: "Artist - Title", kind: Placeholder},
+	{raw: "Untitled", kind: Placeholder},
+	{raw: "♪♪♪", kind: Placeholder},
+
+	// ads
+	{raw: "Ad Break", kind: Ad},
+	{raw: "ADBREAK", kind: Ad},
+	{raw: "Advertisement", kind: Ad},
+	{raw: "Commercial Break - Back Soon", kind: Ad},
+	{raw: "Werbung", kind: Ad},
+	{raw: "Publicidad", kind: Ad},
+	{raw: "adswizz_preroll_123", kind: Ad},
+	{raw: "Text JAZZ to 80800 for a chance to win", kind: Ad},
+	{raw: "Our Sponsors - Thank you", kind: Ad},
+	{raw: "Commercial", kind: Ad},
+	{raw: "Promo", kind: Ad},
+	{raw: "Promo Spot 3", kind: Ad},
+
+	// songs that only mention ads
+	{raw: "The Commercials - Spotlight", artist: "The Commercials", title: "Spotlight"},
+	{raw: "Promo - Song", artist: "Promo", title: "Song"},
+	{raw: "Rick James - Commercial Love", artist: "Rick James", title: "Commercial Love"},
+	// "commercial break" has to end at a word boundary, "Breakdown" isn't a break
+	{raw: "Commercial Breakdown - Midnight Oil", artist: "Commercial Breakdown", title: "Midnight Oil"},
+
+	// slogans
+	{raw: "Jazz FM", kind: Slogan},
+	{raw: "Radio Paradise", kind: Slogan},
+	{raw: "www.radioparadise.com", kind: Slogan},
+	{raw: "https://somafm.com - listener supported", kind: Slogan},
+	{raw: "You're listening to KEXP", kind: Slogan},
+	{raw: "The Best Music Mix 24/7", kind: Slogan},
+	{raw: "Station ID", kind: Slogan},
+	{raw: "Jingle", kind: Slogan},
+	{raw: "Hit Radio FM - Your #1 Hit Station", kind: Slogan},
+	{raw: "Radio Swiss Jazz - www.radioswissjazz.ch", kind: Slogan},
+	{raw: "Commercial free radio", kind: Slogan},
+}
+
+func TestParseTitle(t *testing.T) {
+	for _, tt := range titleCorpus {
+		got := ParseTitle(tt.raw)
+		if got.Raw != tt.raw {
+			t.Errorf("ParseTitle(%q).Raw = %q", tt.raw, got.Raw)
+		}
+		if got.Kind != tt.kind {
+			t.Errorf("ParseTitle(%q).Kind = %v, want %v", tt.raw, got.Kind, tt.kind)
+			continue
+		}
+		if got.Artist != tt.artist || got.Title != tt.title || got.Album != tt.album {
+			t.Errorf("ParseTitle(%q) = artist %q title %q album %q, want %q %q %q", tt.raw, got.Artist, got.Title, got.Album, tt.artist, tt.title, tt.album)
+		}
+		if len(got.Extras) != 0 || len(tt.extras) != 0 {
+			if !reflect.DeepEqual(got.Extras, tt.extras) {
+				t.Errorf("ParseTitle(%q).Extras = %q, want %q", tt.raw, got.Extras, tt.extras)
+			}
+		}
+	}
+}
+
+func TestTitleStringAndQuery(t *testing.T) {
+	song := ParseTitle("Now Playing: Gorillaz - Feel Good Inc. (feat. De La Soul)")
+	if song.String() != "Gorillaz - Feel Good Inc." {
+		t.Errorf("String() = %q", song.String())
+	}
+	if song.Query() != "Gorillaz Feel Good Inc." {
+		t.Errorf("Query() = %q", song.Query())
+	}
+	if ad := ParseTitle("Ad Break"); ad.String() != "Ad Break" || ad.IsSong() {
+		t.Errorf("ad = %+v", ad)
+	}
+}
+
+func FuzzParseTitle(f *testing.F) {
+	for _, tt := range titleCorpus {
+		f.Add(tt.raw)
+	}
+	f.Add("((((")
+	f.Add("feat.")
+	f.Add(" by ")
+	f.Add("a - (b) - [c] - d")
+	f.Add("\xff\xfe - \x80")
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		for _, hint := range []Hint{{}, {CountryCode: "RU"}, {CountryCode: "JP"}} {
+			if repaired := Repair(raw, hint); !utf8.ValidString(repaired) {
+				t.Fatalf("Repair(%q, %v) = invalid UTF-8 %q", raw, hint, repaired)
+			}
+		}
+
+		got := ParseTitle(raw)
+		if got.Raw != raw {
+			t.Fatalf("Raw changed: %q", got.Raw)
+		}
+		if got.Kind != Song {
+			if got.Artist != "" || got.Title != "" || got.Album != "" || len(got.Extras) != 0 {
+				t.Fatalf("%v with parts: %+v", got.Kind, got)
+			}
+			return
+		}
+		if got.Title == "" {
+			t.Fatalf("song without a title: %+v", got)
+		}
+		for _, part := range append([]string{got.Artist, got.Title, got.Album}, got.Extras...) {
+			if !utf8.ValidString(part) {
+				t.Fatalf("invalid UTF-8 in %+v", got)
+			}
+			if part != strings.TrimSpace(part) {
+				t.Fatalf("untrimmed part %q in %+v", part, got)
+			}
+		}
+		// the cleaned up form should be stable
+		again := ParseTitle(got.String())
+		if again.Kind == Song && again.Title == "" {
+			t.Fatalf("reparse of %q lost the title", got.String())
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package playback
+
+import "sync"
+
+// subscriberBuffer is how far a subscriber can fall behind before it starts missing events
+const subscriberBuffer = 64
+
+// Bus fans events out to everyone who subscribed to their kind: the REPL, the listen log
+// and anything else that wants to know what's playing
+type Bus struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]bool
+	closed bool
+}
+
+// Subscription receives the events it asked for until Unsubscribe or the bus closes
+type Subscription struct {
+	bus    *Bus
+	kinds  map[EventKind]bool // nil for everything
+	events chan Event
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[*Subscription]bool{}}
+}
+
+// Subscribe delivers events of the given kinds, or all of them when none are given
+func (b *Bus) Subscribe(kinds ...EventKind) *Subscription {
+	s := &Subscription{bus: b, events: make(chan Event, subscriberBuffer)}
+	if len(kinds) > 0 {
+		s.kinds = map[EventKind]bool{}
+		for _, k := range kinds {
+			s.kinds[k] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.events)
+		return s
+	}
+	b.subs[s] = true
+	return s
+}
+
+// Publish hands e to every interested subscriber. It never blocks: a subscriber whose
+// buffer is full misses the event rather than holding up playback.
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		if s.kinds == nil || s.kinds[e.Kind] {
+			forward(s.events, e)
+		}
+	}
+}
+
+// Close ends every subscription, later ones start out closed
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for s := range b.subs {
+		close(s.events)
+	}
+	b.subs = nil
+}
+
+// Events is closed once the subscription ends, so it can be ranged over
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Unsubscribe stops delivery and closes Events. It's safe to call more than once.
+func (s *Subscription) Unsubscribe() {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.subs[s] {
+		return
+	}
+	delete(b.subs, s)
+	close(s.events)
+}
@@ -0,0 +1,70 @@
+package playback
+
+import (
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, s *Subscription) Event {
+	t.Helper()
+	select {
+	case e, ok := <-s.Events():
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event")
+	}
+	return Event{}
+}
+
+func TestBusFiltersByKind(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+	all := bus.Subscribe()
+	songs := bus.Subscribe(SongChanged, SongAdded)
+
+	bus.Publish(Event{Kind: StationStarted})
+	bus.Publish(Event{Kind: SongChanged, Title: "one"})
+	bus.Publish(Event{Kind: SongAdded, Title: "one"})
+
+	for _, want := range []EventKind{StationStarted, SongChanged, SongAdded} {
+		if e := receive(t, all); e.Kind != want {
+			t.Errorf("all got %v, want %v", e.Kind, want)
+		}
+	}
+	for _, want := range []EventKind{SongChanged, SongAdded} {
+		if e := receive(t, songs); e.Kind != want {
+			t.Errorf("songs got %v, want %v", e.Kind, want)
+		}
+	}
+	select {
+	case e := <-songs.Events():
+		t.Errorf("songs got %v, it didn't subscribe to that", e.Kind)
+	default:
+	}
+}
+
+func TestBusUnsubscribe(t *testing.T) {
+	bus := NewBus()
+	s := bus.Subscribe()
+	s.Unsubscribe()
+	s.Unsubscribe()
+	bus.Publish(Event{Kind: SongChanged})
+	if _, ok := <-s.Events(); ok {
+		t.Error("got an event after Unsubscribe")
+	}
+
+	// a subscriber that stops reading doesn't hold up everyone else
+	stuck, fine := bus.Subscribe(), bus.Subscribe()
+	for i := 0; i < subscriberBuffer+10; i++ {
+		bus.Publish(Event{Kind: SongChanged})
+		receive(t, fine)
+	}
+	bus.Close()
+	if n := len(stuck.Events()); n != subscriberBuffer {
+		t.Errorf("stuck subscriber has %d events buffered, want %d", n, subscriberBuffer)
+	}
+	stuck.Unsubscribe()
+}
@@ -0,0 +1,318 @@
+package playback
+
+import (
+	"bufio"
+	"cli-radio/api"
+	"cli-radio/icy"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeadAirOptions watches for stations that go quiet, turn to talk or break for ads
+type DeadAirOptions struct {
+	// Action is what to do about it: off (default), warn or skip
+	Action string `json:"action"`
+	// SilenceSeconds of audio below SilenceDB counts as dead air, 0 to not listen for it.
+	// It takes ffmpeg, and a second connection to the station when time-shift is off.
+	SilenceSeconds float64 `json:"silence_seconds"`
+	SilenceDB      float64 `json:"silence_db"`
+	// NoSongMinutes without a song title counts as talk, 0 to not wait for one
+	NoSongMinutes float64 `json:"no_song_minutes"`
+	// Patterns are regular expressions (case-insensitive) for ad and jingle titles, on top
+	// of the ad breaks the title parser already spots
+	Patterns []string `json:"patterns"`
+}
+
+const (
+	defaultSilenceDB = -50
+	// chunks of played audio waiting for the silence detector, any more are dropped rather
+	// than hold up playback
+	tapBuffer = 64
+)
+
+// Skip reports whether dead air should move on to the next station rather than just warn
+func (o DeadAirOptions) Skip() bool {
+	return strings.EqualFold(o.Action, "skip")
+}
+
+func (o DeadAirOptions) enabled() bool {
+	return o.Skip() || strings.EqualFold(o.Action, "warn")
+}
+
+// compile checks the options and compiles the title patterns
+func (o DeadAirOptions) compile() ([]*regexp.Regexp, error) {
+	switch strings.ToLower(o.Action) {
+	case "", "off", "warn", "skip":
+	default:
+		return nil, fmt.Errorf("unknown action %q (want off, warn or skip)", o.Action)
+	}
+	if o.SilenceSeconds < 0 || o.NoSongMinutes < 0 {
+		return nil, fmt.Errorf("silence_seconds and no_song_minutes can't be negative, got %v and %v", o.SilenceSeconds, o.NoSongMinutes)
+	}
+	if o.SilenceDB > 0 {
+		return nil, fmt.Errorf("silence_db must be 0 or below, got %v", o.SilenceDB)
+	}
+	patterns := make([]*regexp.Regexp, 0, len(o.Patterns))
+	for _, p := range o.Patterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", p, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+type DeadAirReason int
+
+const (
+	// Silence is the stream going quiet for SilenceSeconds
+	Silence DeadAirReason = iota
+	// NoSongs is NoSongMinutes without a song title, usually talk
+	NoSongs
+	// AdBreak is a title that looks like an ad or a jingle
+	AdBreak
+)
+
+func (r DeadAirReason) String() string {
+	switch r {
+	case Silence:
+		return "silence"
+	case NoSongs:
+		return "no songs"
+	default:
+		return "ad break"
+	}
+}
+
+// deadAir wraps a backend and sends DeadAir when the station goes quiet, stops sending song
+// titles or sends one that looks like an ad. It sits inside the reconnects, so every retry
+// starts listening again.
+type deadAir struct {
+	Backend
+	silence   time.Duration
+	silenceDB float64
+	noSongs   time.Duration
+	patterns  []*regexp.Regexp
+	client    *http.Client
+	// detect listens to audio for silence, calling found for each quiet spell
+	detect func(ctx context.Context, audio io.Reader, found func())
+	events chan Event
+
+	mu      sync.Mutex
+	ctx     context.Context // cancelled when the station stops
+	cancel  context.CancelFunc
+	station *api.Station
+	quiet   *time.Timer // goes off after noSongs without a song
+}
+
+func watchDeadAir(p Backend, opts DeadAirOptions, patterns []*regexp.Regexp) *deadAir {
+	d := &deadAir{
+		Backend:   p,
+		silence:   time.Duration(opts.SilenceSeconds * float64(time.Second)),
+		silenceDB: opts.SilenceDB,
+		noSongs:   time.Duration(opts.NoSongMinutes * float64(time.Minute)),
+		patterns:  patterns,
+		client:    icy.NewClient(),
+		events:    make(chan Event, eventBuffer),
+	}
+	if d.silenceDB == 0 {
+		d.silenceDB = defaultSilenceDB
+	}
+	d.detect = d.detectSilence
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		// nothing to listen with
+		d.silence = 0
+	}
+	go func() {
+		for e := range p.Events() {
+			forward(d.events, e)
+			if e.Kind == SongChanged {
+				d.titleChanged(e)
+			}
+		}
+	}()
+	return d
+}
+
+func (d *deadAir) Play(station *api.Station) error {
+	return d.play(station, false)
+}
+
+// Retry restarts a dropped stream, the time without songs keeps counting across it
+func (d *deadAir) Retry(station *api.Station) error {
+	return d.play(station, true)
+}
+
+func (d *deadAir) play(station *api.Station, retry bool) error {
+	d.stopWatching(retry)
+	if err := d.Backend.Play(station); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.mu.Lock()
+	d.ctx, d.cancel, d.station = ctx, cancel, station
+	if d.noSongs > 0 && d.quiet == nil {
+		d.quiet = time.AfterFunc(d.noSongs, func() {
+			d.mu.Lock()
+			ctx := d.ctx
+			d.mu.Unlock()
+			d.report(ctx, station, Event{Reason: NoSongs})
+		})
+	}
+	d.mu.Unlock()
+
+	if d.silence > 0 && !station.HLS {
+		// HLS is a playlist of segments, there's no one stream to listen to
+		go d.listen(ctx, station)
+	}
+	return nil
+}
+
+func (d *deadAir) Stop() error {
+	d.stopWatching(false)
+	return d.Backend.Stop()
+}
+
+// listen runs the silence detector on the audio the backend plays: what it reads from the
+// time-shift buffer, so rewinds and pauses count, or else the station's own stream
+func (d *deadAir) listen(ctx context.Context, station *api.Station) {
+	audio, feed := io.Pipe()
+	stop := context.AfterFunc(ctx, func() { feed.CloseWithError(ctx.Err()) })
+	defer stop()
+
+	if shift, ok := d.Backend.(*timeShift); ok {
+		chunks := make(chan []byte, tapBuffer)
+		shift.setTap(func(p []byte) {
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case chunks <- append([]byte(nil), p...):
+			default:
+			}
+		})
+		go func() {
+			for {
+				select {
+				case p := <-chunks:
+					if _, err := feed.Write(p); err != nil {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	} else {
+		go func() {
+			stream, err := icy.Open(ctx, d.client, station.StreamURL(), nil)
+			if err != nil {
+				feed.CloseWithError(err)
+				return
+			}
+			defer stream.Close()
+			_, err = io.Copy(feed, stream.Body)
+			feed.CloseWithError(err)
+		}()
+	}
+
+	d.detect(ctx, audio, func() { d.report(ctx, station, Event{Reason: Silence}) })
+	// let the feed go if the detector quit early
+	audio.Close()
+}
+
+func (d *deadAir) Events() <-chan Event {
+	return d.events
+}
+
+// titleChanged flags ad titles, and puts off the no songs warning when a song comes on
+func (d *deadAir) titleChanged(e Event) {
+	d.mu.Lock()
+	ctx, station, quiet := d.ctx, d.station, d.quiet
+	d.mu.Unlock()
+	if station == nil {
+		return
+	}
+	if e.Song.Kind == icy.Ad || d.matches(e.Title) {
+		d.report(ctx, station, Event{Reason: AdBreak, Title: e.Title, Song: e.Song})
+		return
+	}
+	if e.Song.IsSong() && quiet != nil {
+		quiet.Reset(d.noSongs)
+	}
+}
+
+func (d *deadAir) matches(title string) bool {
+	for _, re := range d.patterns {
+		if re.MatchString(title) {
+			return true
+		}
+	}
+	return false
+}
+
+// report sends DeadAir, unless the station it's about has stopped since
+func (d *deadAir) report(ctx context.Context, station *api.Station, e Event) {
+	if ctx.Err() != nil {
+		return
+	}
+	e.Kind, e.Station = DeadAir, station
+	forward(d.events, e)
+}
+
+// stopWatching stops listening, and forgets the station unless it's about to be retried
+func (d *deadAir) stopWatching(retry bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+	if retry {
+		return
+	}
+	if d.quiet != nil {
+		d.quiet.Stop()
+		d.quiet = nil
+	}
+	d.station = nil
+}
+
+// detectSilence runs ffmpeg's silencedetect over audio. It's only a lookout, so if the
+// audio can't be decoded we just don't hear silence.
+func (d *deadAir) detectSilence(ctx context.Context, audio io.Reader, found func()) {
+	filter := fmt.Sprintf("silencedetect=noise=%gdB:duration=%g", d.silenceDB, d.silence.Seconds())
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-nostats", "-loglevel", "info",
+		"-i", "pipe:0", "-vn", "-af", filter, "-f", "null", "-")
+	cmd.Stdin = audio
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		return
+	}
+	scanSilence(stderr, found)
+	cmd.Wait()
+}
+
+// scanSilence calls found for every quiet spell silencedetect logs, it only logs one once
+// it has lasted the whole duration
+func scanSilence(stderr io.Reader, found func()) {
+	scanner := bufio.NewScanner(stderr)
+	scanner.Split(splitLines)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), "silence_start:") {
+			found()
+		}
+	}
+}
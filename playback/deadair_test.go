@@ -0,0 +1,245 @@
+package playback
+
+import (
+	"bytes"
+	"cli-radio/api"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hearing is a silence detector that reports a quiet spell once it has heard n bytes,
+// passing on what it heard
+func hearing(n int, heard chan<- []byte) func(context.Context, io.Reader, func()) {
+	return func(ctx context.Context, audio io.Reader, found func()) {
+		p := make([]byte, n)
+		if _, err := io.ReadFull(audio, p); err != nil {
+			return
+		}
+		heard <- p
+		found()
+	}
+}
+
+// examplePatterns are the patterns config.example.json ships with
+var examplePatterns = []string{`^\s*jingle\s*$`, `^\s*station id\s*$`, `traffic (and|&) weather`}
+
+func TestDeadAir(t *testing.T) {
+	server := streamServer("Quiet FM - Jingle")
+	defer server.Close()
+	fake := NewFake()
+	opts := DeadAirOptions{Action: "skip", SilenceSeconds: 10, NoSongMinutes: 1, Patterns: examplePatterns}
+	patterns, err := opts.compile()
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	d := watchDeadAir(fake, opts, patterns)
+	// turned off without ffmpeg, the stub stands in for it
+	d.silence = 10 * time.Second
+	heard := make(chan []byte, 1)
+	d.detect = hearing(testMetaint, heard)
+
+	station := &api.Station{Name: "Quiet FM", URL: server.URL}
+	if err := d.Play(station); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	if e := nextEvent(t, d); e.Kind != DeadAir || e.Reason != Silence || e.Station != station {
+		t.Fatalf("got %+v, want silence", e)
+	}
+	// without time-shift it listens to the stream, metadata taken out
+	if audio := <-heard; !bytes.Equal(audio, bytes.Repeat([]byte{'a'}, testMetaint)) {
+		t.Errorf("detector heard %q...", audio[:10])
+	}
+
+	fake.Emit(Event{Kind: SongChanged, Title: "Jingle"})
+	if e := nextEvent(t, d); e.Kind != SongChanged {
+		t.Fatalf("got %+v, want the title first", e)
+	}
+	if e := nextEvent(t, d); e.Kind != DeadAir || e.Reason != AdBreak {
+		t.Fatalf("got %+v, want an ad break", e)
+	}
+
+	// a song puts off the no songs warning, which comes once the songs stop
+	d.noSongs = 50 * time.Millisecond
+	fake.Emit(Event{Kind: SongChanged, Title: "Sade - Smooth Operator"})
+	nextEvent(t, d)
+	if e := nextEvent(t, d); e.Kind != DeadAir || e.Reason != NoSongs {
+		t.Fatalf("got %+v, want no songs", e)
+	}
+
+	d.Stop()
+	fake.Emit(Event{Kind: SongChanged, Title: "Jingle"})
+	nextEvent(t, d)
+	select {
+	case e := <-d.Events():
+		t.Errorf("got %+v after stopping", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDeadAirHearsTheTimeShift(t *testing.T) {
+	titles := make(chan string)
+	server := liveServer(titles)
+	defer server.Close()
+
+	fake := NewFake()
+	shift := withTimeShift(fake, TimeShiftOptions{Minutes: 0.1})
+	shift.burst = time.Hour
+	d := watchDeadAir(shift, DeadAirOptions{Action: "warn"}, nil)
+	d.silence = 10 * time.Second
+	var mu sync.Mutex
+	var heard []byte
+	d.detect = func(ctx context.Context, audio io.Reader, found func()) {
+		p := make([]byte, 512)
+		for {
+			n, err := audio.Read(p)
+			mu.Lock()
+			heard = append(heard, p[:n]...)
+			mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	if err := d.Play(&api.Station{Name: "Shifty FM", URL: server.URL}); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	defer d.Stop()
+	titles <- "Sade - Cherish the Day"
+	titles <- "Kelis - Milkshake"
+	waitFor(t, "the buffer", func() bool { _, end := shift.ring.edges(); return end == 2000 })
+
+	// after a rewind the detector hears the same audio again, like the listener does
+	played := listen(t, fake, 2000)
+	if err := shift.Rewind(1500 * time.Millisecond); err != nil {
+		t.Fatalf("Rewind failed: %v", err)
+	}
+	played = append(played, listen(t, fake, 1500)...)
+	waitFor(t, "the detector", func() bool { mu.Lock(); defer mu.Unlock(); return len(heard) >= len(played) })
+	mu.Lock()
+	defer mu.Unlock()
+	if !bytes.Equal(heard, played) {
+		t.Errorf("detector heard %d bytes that differ from the %d played", len(heard), len(played))
+	}
+}
+
+func TestDeadAirRestartsOnRetry(t *testing.T) {
+	server := streamServer("A - One", "B - Two")
+	defer server.Close()
+	fake := NewFake()
+	d := watchDeadAir(fake, DeadAirOptions{Action: "warn"}, nil)
+	d.silence = 10 * time.Second
+	started := make(chan struct{}, 4)
+	d.detect = func(ctx context.Context, audio io.Reader, found func()) {
+		started <- struct{}{}
+		<-ctx.Done()
+	}
+	s := supervise(d, ReconnectOptions{Retries: 2, BackoffSeconds: 0.01})
+	if err := s.Play(&api.Station{Name: "Flaky FM", URL: server.URL}); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	defer s.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("the detector started %d times, want it again after the retry", i)
+		}
+		if i == 0 {
+			fake.Emit(Event{Kind: StreamError})
+		}
+	}
+}
+
+func TestDeadAirRetryKeepsCounting(t *testing.T) {
+	server := streamServer("A - One")
+	defer server.Close()
+	d := watchDeadAir(NewFake(), DeadAirOptions{Action: "warn", NoSongMinutes: 1}, nil)
+	defer d.Stop()
+	station := &api.Station{Name: "Talk FM", URL: server.URL}
+	quiet := func() *time.Timer {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.quiet
+	}
+
+	if err := d.Play(station); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	first := quiet()
+	if err := d.Retry(station); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	if quiet() != first {
+		t.Error("a retry started the no songs count over")
+	}
+	// tuning in to the station again, say with goto, is a fresh start
+	if err := d.Play(station); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	if quiet() == first {
+		t.Error("playing the same station again kept the old no songs count")
+	}
+}
+
+func TestDeadAirOptions(t *testing.T) {
+	tests := []struct {
+		opts DeadAirOptions
+		ok   bool
+	}{
+		{DeadAirOptions{}, true},
+		{DeadAirOptions{Action: "Warn", SilenceSeconds: 15, SilenceDB: -45, Patterns: []string{"promo"}}, true},
+		{DeadAirOptions{Action: "mute"}, false},
+		{DeadAirOptions{Action: "skip", NoSongMinutes: -1}, false},
+		{DeadAirOptions{Action: "skip", SilenceDB: 3}, false},
+		{DeadAirOptions{Action: "skip", Patterns: []string{"(unclosed"}}, false},
+	}
+	for _, tt := range tests {
+		if _, err := tt.opts.compile(); (err == nil) != tt.ok {
+			t.Errorf("compile(%+v) = %v", tt.opts, err)
+		}
+	}
+}
+
+func TestDeadAirExamplePatterns(t *testing.T) {
+	patterns, err := DeadAirOptions{Patterns: examplePatterns}.compile()
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	d := &deadAir{patterns: patterns}
+	tests := []struct {
+		title string
+		want  bool
+	}{
+		{"Jingle", true},
+		{" STATION ID ", true},
+		{"Traffic & Weather on the 8s", true},
+		// songs that only mention a jingle or a promo are still songs
+		{"Bobby Helms - Jingle Bell Rock", false},
+		{"Quiet FM Jingle Mix - Various", false},
+		{"Promo - Song", false},
+	}
+	for _, tt := range tests {
+		if got := d.matches(tt.title); got != tt.want {
+			t.Errorf("matches(%q) = %v, want %v", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestScanSilence(t *testing.T) {
+	stderr := strings.Join([]string{
+		"Input #0, mp3, from 'http://example.com/quiet':",
+		"[silencedetect @ 0x7f8] silence_start: 61.2",
+		"size=N/A time=00:01:20.00 bitrate=N/A speed=1x\r[silencedetect @ 0x7f8] silence_end: 81.5 | silence_duration: 20.3",
+		"[silencedetect @ 0x7f8] silence_start: 140.02",
+	}, "\n")
+	n := 0
+	scanSilence(strings.NewReader(stderr), func() { n++ })
+	if n != 2 {
+		t.Errorf("found %d quiet spells, want 2", n)
+	}
+}
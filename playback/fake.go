@@ -0,0 +1,94 @@
+package playback
+
+import (
+	"cli-radio/api"
+	"cli-radio/icy"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Fake is a Backend that plays nothing and records what it was asked to do, for tests
+type Fake struct {
+	mu      sync.Mutex
+	URL     string
+	Station string
+	Playing bool
+	Paused  bool
+	Volume  int
+	EQ      string
+	Calls   []string
+	// PlayErr, if set, is returned by the next Play call
+	PlayErr error
+	events  chan Event
+	charset icy.Hint
+}
+
+func NewFake() *Fake {
+	return &Fake{Volume: 100, EQ: flatEQ, events: make(chan Event, eventBuffer)}
+}
+
+func (f *Fake) Play(station *api.Station) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	url := station.StreamURL()
+	f.Calls = append(f.Calls, "play "+url)
+	if err := f.PlayErr; err != nil {
+		f.PlayErr = nil
+		return err
+	}
+	f.URL, f.Station, f.Playing, f.Paused = url, station.Name, true, false
+	f.charset = charsetHint(station)
+	return nil
+}
+
+func (f *Fake) Stop() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Calls = append(f.Calls, "stop")
+	f.Playing, f.Paused = false, false
+	return nil
+}
+
+func (f *Fake) Pause(paused bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.Playing {
+		return errors.New("nothing playing")
+	}
+	f.Calls = append(f.Calls, "pause")
+	f.Paused = paused
+	return nil
+}
+
+func (f *Fake) SetVolume(percent int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Calls = append(f.Calls, "volume")
+	f.Volume = percent
+	return nil
+}
+
+func (f *Fake) SetEQ(preset string) error {
+	preset = strings.ToLower(preset)
+	if _, ok := EQPresets[preset]; !ok {
+		return unknownEQ(preset)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Calls = append(f.Calls, "eq "+preset)
+	f.EQ = preset
+	return nil
+}
+
+func (f *Fake) Events() <-chan Event {
+	return f.events
+}
+
+// Emit pretends the stream produced an event
+func (f *Fake) Emit(e Event) {
+	f.mu.Lock()
+	charset := f.charset
+	f.mu.Unlock()
+	f.events <- parseSong(e, charset)
+}
@@ -0,0 +1,114 @@
+package playback
+
+import (
+	"bufio"
+	"cli-radio/api"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// FFplay plays streams with ffplay from FFmpeg, for machines without mpv
+type FFplay struct {
+	run *runner
+}
+
+func NewFFplay() *FFplay {
+	return &FFplay{run: newRunner()}
+}
+
+func (f *FFplay) Play(station *api.Station) error {
+	if _, err := exec.LookPath("ffplay"); err != nil {
+		return fmt.Errorf("ffplay not found, install FFmpeg with 'brew install ffmpeg': %w", err)
+	}
+	f.Stop()
+
+	f.run.mu.Lock()
+	volume := f.run.volume
+	f.run.mu.Unlock()
+
+	args := []string{"-nodisp", "-vn", "-loglevel", "info", "-volume", fmt.Sprint(volume)}
+	if chain := f.run.filterChain(); chain != "" {
+		args = append(args, "-af", chain)
+	}
+	cmd := exec.Command("ffplay", append(args, station.StreamURL())...)
+	out, in := io.Pipe()
+	// ffplay writes its metadata to stderr
+	cmd.Stderr = in
+	if err := f.run.start(cmd, charsetHint(station), func() { in.Close() }); err != nil {
+		return fmt.Errorf("failed to play %s: %w", station.Name, err)
+	}
+	go scanFFplayOutput(out, f.run.emit)
+	return nil
+}
+
+func (f *FFplay) Stop() error {
+	return f.run.stop()
+}
+
+func (f *FFplay) Pause(paused bool) error {
+	return f.run.pause(paused)
+}
+
+// SetVolume only takes effect on the next station, ffplay reads its volume once at startup
+func (f *FFplay) SetVolume(percent int) error {
+	f.run.mu.Lock()
+	f.run.volume = percent
+	f.run.mu.Unlock()
+	if f.run.running() {
+		return fmt.Errorf("%w: ffplay will use the new volume from the next station", errors.ErrUnsupported)
+	}
+	return nil
+}
+
+// SetEQ only takes effect on the next station, ffplay can't change its filters while playing
+func (f *FFplay) SetEQ(preset string) error {
+	if _, err := f.run.setEQ(preset); err != nil {
+		return err
+	}
+	if f.run.running() {
+		return fmt.Errorf("%w: ffplay will use the new EQ from the next station", errors.ErrUnsupported)
+	}
+	return nil
+}
+
+func (f *FFplay) Events() <-chan Event {
+	return f.run.events
+}
+
+// scanFFplayOutput picks StreamTitle/icy-title out of the metadata ffplay logs
+func scanFFplayOutput(stderr io.Reader, emit func(Event)) {
+	scanner := bufio.NewScanner(stderr)
+	// ffplay redraws its status line with \r, so split on those too
+	scanner.Split(splitLines)
+	var last string
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if key != "StreamTitle" && key != "icy-title" {
+			continue
+		}
+		title := strings.TrimSpace(value)
+		if title != last {
+			last = title
+			emit(Event{Kind: SongChanged, Title: title})
+		}
+	}
+}
+
+func splitLines(data []byte, atEOF bool) (int, []byte, error) {
+	for i, b := range data {
+		if b == '\n' || b == '\r' {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
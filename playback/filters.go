@@ -0,0 +1,116 @@
+package playback
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FilterOptions configures the audio filters every stream goes through
+type FilterOptions struct {
+	// Normalize is loudnorm (default), dynaudnorm (much lighter on the CPU) or off
+	Normalize string `json:"normalize"`
+	// loudnorm targets: integrated loudness in LUFS, true peak in dBTP and loudness range in LU,
+	// nil when the config leaves them out since 0 dBTP is a real setting
+	Loudness *float64 `json:"loudness"`
+	TruePeak *float64 `json:"true_peak"`
+	Range    *float64 `json:"range"`
+	// EQ is the preset to start with, see EQPresets
+	EQ string `json:"eq"`
+}
+
+const flatEQ = "flat"
+
+var defaultFilters = FilterOptions{Normalize: "loudnorm", Loudness: level(-16), TruePeak: level(-1.5), Range: level(11), EQ: flatEQ}
+
+// level is a filter target for FilterOptions
+func level(v float64) *float64 {
+	return &v
+}
+
+// EQPresets are the named ffmpeg filter chains `eq <preset>` switches between
+var EQPresets = map[string]string{
+	flatEQ: "",
+	"bass": "bass=g=6:f=110:w=0.6",
+	// cut the rumble and hiss, lift the presence range so talk is easier to follow
+	"voice": "highpass=f=120,lowpass=f=7000,equalizer=f=2500:t=q:w=1.2:g=4",
+	// squash the dynamics so quiet parts stay audible at low volume and nothing jumps out
+	"night":  "acompressor=threshold=-24dB:ratio=6:attack=10:release=250:makeup=6,highshelf=f=6000:g=-3",
+	"treble": "treble=g=5:f=3500",
+}
+
+// EQNames lists the presets in alphabetical order
+func EQNames() []string {
+	names := make([]string, 0, len(EQPresets))
+	for name := range EQPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// withDefaults fills in whatever the config left out and checks the rest
+func (o FilterOptions) withDefaults() (FilterOptions, error) {
+	o.Normalize = strings.ToLower(o.Normalize)
+	if o.Normalize == "" {
+		o.Normalize = defaultFilters.Normalize
+	}
+	if o.Loudness == nil {
+		o.Loudness = defaultFilters.Loudness
+	}
+	if o.TruePeak == nil {
+		o.TruePeak = defaultFilters.TruePeak
+	}
+	if o.Range == nil {
+		o.Range = defaultFilters.Range
+	}
+	o.EQ = o.Preset()
+
+	switch o.Normalize {
+	case "loudnorm", "dynaudnorm", "off":
+	default:
+		return o, fmt.Errorf("unknown normalize filter %q (want loudnorm, dynaudnorm or off)", o.Normalize)
+	}
+	// the ranges ffmpeg's loudnorm accepts
+	if *o.Loudness < -70 || *o.Loudness > -5 {
+		return o, fmt.Errorf("loudness must be between -70 and -5 LUFS, got %v", *o.Loudness)
+	}
+	if *o.TruePeak < -9 || *o.TruePeak > 0 {
+		return o, fmt.Errorf("true_peak must be between -9 and 0 dBTP, got %v", *o.TruePeak)
+	}
+	if *o.Range < 1 || *o.Range > 50 {
+		return o, fmt.Errorf("range must be between 1 and 50 LU, got %v", *o.Range)
+	}
+	if _, ok := EQPresets[o.EQ]; !ok {
+		return o, unknownEQ(o.EQ)
+	}
+	return o, nil
+}
+
+// Preset is the EQ preset playback starts with
+func (o FilterOptions) Preset() string {
+	if o.EQ == "" {
+		return defaultFilters.EQ
+	}
+	return strings.ToLower(o.EQ)
+}
+
+// Chain builds the ffmpeg filter graph for the options, "" when there's nothing to do
+func (o FilterOptions) Chain() string {
+	var filters []string
+	if eq := EQPresets[o.EQ]; eq != "" {
+		filters = append(filters, eq)
+	}
+	switch o.Normalize {
+	case "loudnorm":
+		// loudnorm resamples to 192kHz internally, bring it back down
+		filters = append(filters, fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g", *o.Loudness, *o.TruePeak, *o.Range), "aresample=44100")
+	case "dynaudnorm":
+		filters = append(filters, "dynaudnorm")
+	}
+	return strings.Join(filters, ",")
+}
+
+func unknownEQ(preset string) error {
+	return fmt.Errorf("unknown EQ preset %q (want one of %s)", preset, strings.Join(EQNames(), ", "))
+}
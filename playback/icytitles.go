@@ -0,0 +1,73 @@
+package playback
+
+import (
+	"cli-radio/api"
+	"cli-radio/icy"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// icyTitles wraps a backend and reads song titles straight from the stream with the Go
+// ICY client, ignoring whatever titles the backend reports
+type icyTitles struct {
+	Backend
+	client *http.Client
+	events chan Event
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+func withICYTitles(p Backend) *icyTitles {
+	t := &icyTitles{Backend: p, client: icy.NewClient(), events: make(chan Event, eventBuffer)}
+	go func() {
+		for e := range p.Events() {
+			if e.Kind != SongChanged {
+				forward(t.events, e)
+			}
+		}
+	}()
+	return t
+}
+
+func (t *icyTitles) Play(station *api.Station) error {
+	t.stopWatching()
+	if err := t.Backend.Play(station); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.mu.Lock()
+	t.cancel = cancel
+	t.mu.Unlock()
+
+	charset := charsetHint(station)
+	go icy.Watch(ctx, t.client, station.StreamURL(), nil, func(m icy.Metadata) {
+		if ctx.Err() != nil {
+			return
+		}
+		title := strings.TrimSpace(m.StreamTitle)
+		sendEvent(t.events, Event{Kind: SongChanged, Title: title}, charset)
+	})
+	return nil
+}
+
+func (t *icyTitles) Stop() error {
+	t.stopWatching()
+	return t.Backend.Stop()
+}
+
+func (t *icyTitles) Events() <-chan Event {
+	return t.events
+}
+
+func (t *icyTitles) stopWatching() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancel != nil {
+		t.cancel()
+		t.cancel = nil
+	}
+}
@@ -0,0 +1,64 @@
+package playback
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+// id3Tags are the text frames written at the start of a recorded track
+type id3Tags struct {
+	Title   string
+	Artist  string
+	Album   string
+	Station string
+	Comment string
+}
+
+// id3v2 builds an ID3v2.3 tag. MP3 and ADTS AAC players skip it as junk before the first
+// frame if they don't read tags, so it can go straight in front of the audio.
+func id3v2(tags id3Tags) []byte {
+	var frames bytes.Buffer
+	for _, f := range []struct{ id, value string }{
+		{"TIT2", tags.Title},
+		{"TPE1", tags.Artist},
+		{"TALB", tags.Album},
+		{"TRSN", tags.Station},
+	} {
+		if f.value != "" {
+			writeFrame(&frames, f.id, textFrame(f.value))
+		}
+	}
+	if tags.Comment != "" {
+		// encoding, language, empty description, then the text
+		data := append([]byte{1, 'e', 'n', 'g'}, utf16Text("")...)
+		writeFrame(&frames, "COMM", append(data, utf16Text(tags.Comment)...))
+	}
+
+	size := frames.Len()
+	header := []byte{'I', 'D', '3', 3, 0, 0,
+		// the tag size is "syncsafe": 7 bits per byte
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(header, frames.Bytes()...)
+}
+
+func writeFrame(w *bytes.Buffer, id string, data []byte) {
+	w.WriteString(id)
+	binary.Write(w, binary.BigEndian, uint32(len(data)))
+	w.Write([]byte{0, 0}) // flags
+	w.Write(data)
+}
+
+// textFrame is UTF-16 since ID3v2.3 has no UTF-8 encoding
+func textFrame(s string) []byte {
+	return append([]byte{1}, utf16Text(s)...)
+}
+
+// utf16Text is s as little endian UTF-16 with a byte order mark and a terminating null
+func utf16Text(s string) []byte {
+	out := []byte{0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(u), byte(u>>8))
+	}
+	return append(out, 0, 0)
+}
@@ -0,0 +1,232 @@
+package playback
+
+import (
+	"cli-radio/api"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// property ids for observe_property, echoed back in property-change events
+const (
+	propMetadata = iota + 1
+	propMediaTitle
+	propPause
+	propVolume
+	propCacheState
+)
+
+var observedProperties = map[int]string{
+	propMetadata:   "metadata",
+	propMediaTitle: "media-title",
+	propPause:      "pause",
+	propVolume:     "volume",
+	propCacheState: "demuxer-cache-state",
+}
+
+// MPVState is the latest value of every property we observe
+type MPVState struct {
+	MediaTitle    string
+	Metadata      map[string]string
+	Paused        bool
+	Volume        float64
+	CacheDuration float64 // seconds of audio buffered ahead
+}
+
+// MPV plays streams with mpv, driving it over its JSON IPC socket
+type MPV struct {
+	run *runner
+
+	mu         sync.Mutex
+	ipc        *ipcConn
+	generation int // bumped on every Play/Stop so events from an old mpv are ignored
+	lastTitle  string
+	state      MPVState
+}
+
+func NewMPV() *MPV {
+	return &MPV{run: newRunner()}
+}
+
+func (m *MPV) Play(station *api.Station) error {
+	if _, err := exec.LookPath("mpv"); err != nil {
+		return fmt.Errorf("mpv not found, install it with 'brew install mpv': %w", err)
+	}
+	m.Stop()
+
+	m.mu.Lock()
+	m.generation++
+	socket := filepath.Join(os.TempDir(), fmt.Sprintf("cli-radio-mpv-%d-%d.sock", os.Getpid(), m.generation))
+	m.mu.Unlock()
+	os.Remove(socket)
+
+	m.run.mu.Lock()
+	volume := m.run.volume
+	m.run.mu.Unlock()
+
+	args := []string{"--no-video", "--no-terminal", fmt.Sprintf("--volume=%d", volume), "--input-ipc-server=" + socket}
+	if chain := m.run.filterChain(); chain != "" {
+		args = append(args, "--af="+lavfi(chain))
+	}
+	cmd := exec.Command("mpv", append(args, station.StreamURL())...)
+	if err := m.run.start(cmd, charsetHint(station), func() { os.Remove(socket) }); err != nil {
+		return fmt.Errorf("failed to play %s: %w", station.Name, err)
+	}
+	if err := m.connect(socket); err != nil {
+		m.Stop()
+		return fmt.Errorf("failed to play %s: %w", station.Name, err)
+	}
+	return nil
+}
+
+// connect attaches to mpv's IPC socket and subscribes to the properties we track
+func (m *MPV) connect(socket string) error {
+	m.mu.Lock()
+	generation := m.generation
+	m.lastTitle = ""
+	m.state = MPVState{}
+	m.mu.Unlock()
+
+	conn, err := dialIPC(socket, ipcDialTimeout, func(msg ipcMessage) {
+		m.handleEvent(generation, msg)
+	})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.ipc = conn
+	m.mu.Unlock()
+
+	for id := propMetadata; id <= propCacheState; id++ {
+		if err := conn.observe(id, observedProperties[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MPV) Stop() error {
+	m.mu.Lock()
+	if m.ipc != nil {
+		m.ipc.close()
+		m.ipc = nil
+	}
+	m.generation++
+	m.mu.Unlock()
+	return m.run.stop()
+}
+
+func (m *MPV) Pause(paused bool) error {
+	if conn := m.conn(); conn != nil {
+		return conn.setProperty("pause", paused)
+	}
+	return m.run.pause(paused)
+}
+
+func (m *MPV) SetVolume(percent int) error {
+	m.run.mu.Lock()
+	m.run.volume = percent
+	m.run.mu.Unlock()
+	if conn := m.conn(); conn != nil {
+		return conn.setProperty("volume", percent)
+	}
+	return nil
+}
+
+// SetEQ rebuilds mpv's audio filters in place, the stream keeps playing
+func (m *MPV) SetEQ(preset string) error {
+	chain, err := m.run.setEQ(preset)
+	if err != nil {
+		return err
+	}
+	if conn := m.conn(); conn != nil {
+		return conn.setProperty("af", lavfi(chain))
+	}
+	return nil
+}
+
+func (m *MPV) Events() <-chan Event {
+	return m.run.events
+}
+
+// State returns the last values mpv reported
+func (m *MPV) State() MPVState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state := m.state
+	state.Metadata = make(map[string]string, len(m.state.Metadata))
+	for k, v := range m.state.Metadata {
+		state.Metadata[k] = v
+	}
+	return state
+}
+
+func (m *MPV) conn() *ipcConn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ipc
+}
+
+func (m *MPV) handleEvent(generation int, msg ipcMessage) {
+	if msg.Event != "property-change" || len(msg.Data) == 0 || string(msg.Data) == "null" {
+		return
+	}
+
+	m.mu.Lock()
+	if generation != m.generation {
+		m.mu.Unlock()
+		return
+	}
+	var song string
+	switch msg.ID {
+	case propMetadata:
+		var raw map[string]any
+		if json.Unmarshal(msg.Data, &raw) != nil {
+			break
+		}
+		m.state.Metadata = map[string]string{}
+		for k, v := range raw {
+			m.state.Metadata[strings.ToLower(k)] = fmt.Sprint(v)
+		}
+		title, ok := m.state.Metadata["icy-title"]
+		if !ok {
+			break
+		}
+		title = strings.TrimSpace(title)
+		if title != m.lastTitle {
+			m.lastTitle = title
+			song = title
+		}
+	case propMediaTitle:
+		json.Unmarshal(msg.Data, &m.state.MediaTitle)
+	case propPause:
+		json.Unmarshal(msg.Data, &m.state.Paused)
+	case propVolume:
+		json.Unmarshal(msg.Data, &m.state.Volume)
+	case propCacheState:
+		var cache struct {
+			CacheDuration float64 `json:"cache-duration"`
+		}
+		if json.Unmarshal(msg.Data, &cache) == nil {
+			m.state.CacheDuration = cache.CacheDuration
+		}
+	}
+	m.mu.Unlock()
+
+	if song != "" {
+		m.run.emit(Event{Kind: SongChanged, Title: song})
+	}
+}
+
+// lavfi wraps an ffmpeg filter graph for mpv's --af, "" clears the filters
+func lavfi(chain string) string {
+	if chain == "" {
+		return ""
+	}
+	return "lavfi=[" + chain + "]"
+}
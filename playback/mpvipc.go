@@ -0,0 +1,145 @@
+package playback
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const ipcDialTimeout = 5 * time.Second
+
+// ipcMessage is anything mpv writes on its JSON IPC socket: a reply carries a request_id,
+// an event carries an event name (and for property changes, the property)
+type ipcMessage struct {
+	RequestID int64           `json:"request_id"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+	Event     string          `json:"event"`
+	ID        int64           `json:"id"`
+	Name      string          `json:"name"`
+}
+
+// ipcConn is a connection to mpv's --input-ipc-server socket
+type ipcConn struct {
+	conn net.Conn
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan ipcMessage
+	closed  bool
+}
+
+// dialIPC waits for mpv to create its socket and connects to it
+func dialIPC(path string, timeout time.Duration, onEvent func(ipcMessage)) (*ipcConn, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			c := &ipcConn{conn: conn, pending: map[int64]chan ipcMessage{}}
+			go c.readLoop(onEvent)
+			return c, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("could not connect to mpv IPC socket: %w", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// command sends a command and waits for mpv's reply
+func (c *ipcConn) command(args ...any) (json.RawMessage, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errors.New("mpv IPC connection closed")
+	}
+	c.nextID++
+	id := c.nextID
+	reply := make(chan ipcMessage, 1)
+	c.pending[id] = reply
+	c.mu.Unlock()
+
+	line, err := json.Marshal(map[string]any{"command": args, "request_id": id})
+	if err != nil {
+		return nil, err
+	}
+	c.writeMu.Lock()
+	_, err = c.conn.Write(append(line, '\n'))
+	c.writeMu.Unlock()
+	if err != nil {
+		c.forget(id)
+		return nil, fmt.Errorf("failed to send mpv command: %w", err)
+	}
+
+	select {
+	case msg, ok := <-reply:
+		if !ok {
+			return nil, errors.New("mpv IPC connection closed")
+		}
+		if msg.Error != "success" {
+			return nil, fmt.Errorf("mpv %v: %s", args[0], msg.Error)
+		}
+		return msg.Data, nil
+	case <-time.After(ipcDialTimeout):
+		c.forget(id)
+		return nil, fmt.Errorf("mpv %v: timed out", args[0])
+	}
+}
+
+// observe asks mpv to send property-change events for name
+func (c *ipcConn) observe(id int, name string) error {
+	_, err := c.command("observe_property", id, name)
+	return err
+}
+
+func (c *ipcConn) setProperty(name string, value any) error {
+	_, err := c.command("set_property", name, value)
+	return err
+}
+
+func (c *ipcConn) close() {
+	c.conn.Close()
+}
+
+func (c *ipcConn) forget(id int64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *ipcConn) readLoop(onEvent func(ipcMessage)) {
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg ipcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Event != "" {
+			onEvent(msg)
+			continue
+		}
+		c.mu.Lock()
+		reply, ok := c.pending[msg.RequestID]
+		delete(c.pending, msg.RequestID)
+		c.mu.Unlock()
+		if ok {
+			reply <- msg
+		}
+	}
+
+	// wake up anyone still waiting on a reply
+	c.mu.Lock()
+	c.closed = true
+	for id, reply := range c.pending {
+		close(reply)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+}
@@ -0,0 +1,195 @@
+package playback
+
+import (
+	"bufio"
+	"cli-radio/icy"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMPV speaks enough of mpv's JSON IPC protocol to drive the MPV backend without mpv
+type fakeMPV struct {
+	t        *testing.T
+	listener net.Listener
+	socket   string
+
+	mu       sync.Mutex
+	conn     net.Conn
+	commands [][]any
+}
+
+func newFakeMPV(t *testing.T) *fakeMPV {
+	socket := filepath.Join(t.TempDir(), "mpv.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", socket, err)
+	}
+	f := &fakeMPV{t: t, listener: listener, socket: socket}
+	t.Cleanup(func() { listener.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeMPV) serve() {
+	conn, err := f.listener.Accept()
+	if err != nil {
+		return
+	}
+	f.mu.Lock()
+	f.conn = conn
+	f.mu.Unlock()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req struct {
+			Command   []any `json:"command"`
+			RequestID int64 `json:"request_id"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			f.t.Errorf("fake mpv got bad json %q: %v", scanner.Text(), err)
+			continue
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, req.Command)
+		f.mu.Unlock()
+		f.send(map[string]any{"request_id": req.RequestID, "error": "success", "data": nil})
+	}
+}
+
+// send writes one message to the client, like mpv does for replies and events
+func (f *fakeMPV) send(msg map[string]any) {
+	line, _ := json.Marshal(msg)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.conn != nil {
+		f.conn.Write(append(line, '\n'))
+	}
+}
+
+func (f *fakeMPV) propertyChange(id int, name string, data any) {
+	f.send(map[string]any{"event": "property-change", "id": id, "name": name, "data": data})
+}
+
+func (f *fakeMPV) received() [][]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]any(nil), f.commands...)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMPVObservesProperties(t *testing.T) {
+	fake := newFakeMPV(t)
+	m := NewMPV()
+	if err := m.connect(fake.socket); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer m.Stop()
+
+	commands := fake.received()
+	if len(commands) != len(observedProperties) {
+		t.Fatalf("got %d commands, want one observe_property per property: %v", len(commands), commands)
+	}
+	for _, c := range commands {
+		if c[0] != "observe_property" {
+			t.Errorf("unexpected command %v", c)
+		}
+	}
+
+	fake.propertyChange(propMetadata, "metadata", map[string]string{"icy-title": "Nina Simone - Sinnerman", "icy-name": "Jazz FM"})
+	// the same title again (e.g. another tag changed) shouldn't be a new song
+	fake.propertyChange(propMetadata, "metadata", map[string]string{"icy-title": "Nina Simone - Sinnerman", "icy-genre": "jazz"})
+	fake.propertyChange(propMetadata, "metadata", map[string]string{"icy-title": "-"})
+	fake.propertyChange(propPause, "pause", true)
+	fake.propertyChange(propVolume, "volume", 55.0)
+	fake.propertyChange(propCacheState, "demuxer-cache-state", map[string]any{"cache-duration": 4.5})
+	fake.propertyChange(propMediaTitle, "media-title", "Jazz FM")
+
+	var titles []string
+	var songs []icy.Title
+	for len(titles) < 2 {
+		select {
+		case e := <-m.Events():
+			titles = append(titles, e.Title)
+			songs = append(songs, e.Song)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only got titles %q", titles)
+		}
+	}
+	if titles[0] != "Nina Simone - Sinnerman" || titles[1] != "-" {
+		t.Errorf("titles = %q", titles)
+	}
+	if songs[0].Artist != "Nina Simone" || songs[1].Kind != icy.Placeholder {
+		t.Errorf("songs = %+v", songs)
+	}
+
+	waitFor(t, "media-title", func() bool { return m.State().MediaTitle == "Jazz FM" })
+	state := m.State()
+	if !state.Paused || state.Volume != 55 || state.CacheDuration != 4.5 || state.Metadata["icy-title"] != "-" {
+		t.Errorf("state = %+v", state)
+	}
+}
+
+func TestMPVCommandsGoOverIPC(t *testing.T) {
+	fake := newFakeMPV(t)
+	m := NewMPV()
+	if err := m.connect(fake.socket); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer m.Stop()
+
+	if err := m.Pause(true); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+	if err := m.SetVolume(30); err != nil {
+		t.Fatalf("SetVolume failed: %v", err)
+	}
+	if err := m.SetEQ("Bass"); err != nil {
+		t.Fatalf("SetEQ failed: %v", err)
+	}
+	if err := m.SetEQ("loud"); err == nil {
+		t.Error("SetEQ should reject unknown presets")
+	}
+
+	commands := fake.received()
+	last := commands[len(commands)-3:]
+	if last[0][0] != "set_property" || last[0][1] != "pause" || last[0][2] != true {
+		t.Errorf("pause sent %v", last[0])
+	}
+	if last[1][0] != "set_property" || last[1][1] != "volume" || last[1][2] != 30.0 {
+		t.Errorf("volume sent %v", last[1])
+	}
+	wantAF := "lavfi=[" + EQPresets["bass"] + ",loudnorm=I=-16:TP=-1.5:LRA=11,aresample=44100]"
+	if last[2][0] != "set_property" || last[2][1] != "af" || last[2][2] != wantAF {
+		t.Errorf("eq sent %v", last[2])
+	}
+}
+
+func TestMPVIgnoresEventsFromOldStream(t *testing.T) {
+	fake := newFakeMPV(t)
+	m := NewMPV()
+	if err := m.connect(fake.socket); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	m.Stop()
+
+	m.handleEvent(m.generation-1, ipcMessage{Event: "property-change", ID: propMetadata, Data: json.RawMessage(`{"icy-title":"Old Song"}`)})
+	select {
+	case e := <-m.Events():
+		t.Errorf("got %+v from a stopped stream", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
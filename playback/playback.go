@@ -1,126 +1,255 @@
 package playback
 
 import (
-	"bufio"
-	"fmt"
-	"log"
-	"os/exec"
+	"cli-radio/api"
+	"cli-radio/icy"
+	"context"
+	"errors"
 	"strings"
 	"sync"
-	"syscall"
+	"time"
 )
 
-var (
-	currentProcess *exec.Cmd
-	CurrentSong    string
-	playbackMutex  sync.Mutex
-)
+var ErrClosed = errors.New("player is closed")
 
-func PlayStation(url string, stationName string) {
-	playbackMutex.Lock()
-	StopPlayback()
-	playbackMutex.Unlock()
+// how often Fade changes the volume
+const fadeStep = 500 * time.Millisecond
 
-	updateCurrentSong("")
+// State is a snapshot of what the player is doing
+type State struct {
+	Station *api.Station // nil when nothing is playing
+	Song    icy.Title    // the latest title from the stream
+	Paused  bool
+	Volume  int
+	EQ      string
+}
 
-	fmt.Printf("Starting playback: %s\n", stationName)
-	// brings every station to the same volume
-	audioFix := "lavfi=[loudnorm=I=-16:TP=-1.5:LRA=11," + "aresample=44100]"
-	currentProcess = exec.Command("mpv", "--no-video", "--af="+audioFix, url)
+// Player owns a backend and everything about what it's playing. Commands and backend
+// events are handled one at a time on the player's own goroutine, so every method is
+// safe to call from anywhere, signal handlers included.
+type Player struct {
+	backend  Backend
+	shift    *timeShift // nil without time-shift
+	commands chan func()
+	bus      *Bus
+	closed   chan struct{}
+	close    sync.Once
+
+	mu    sync.Mutex // only the loop writes state, everyone else reads a copy
+	state State
+}
 
-	stdoutPipe, err := currentProcess.StdoutPipe()
-	if err != nil {
-		log.Fatalf("Failed to create stdout pipe: %v", err)
+func NewPlayer(backend Backend) *Player {
+	p := &Player{
+		backend:  backend,
+		commands: make(chan func()),
+		bus:      NewBus(),
+		closed:   make(chan struct{}),
+		state:    State{Volume: 100, EQ: flatEQ},
 	}
-	// Detach the process
-	currentProcess.SysProcAttr = &syscall.SysProcAttr{
-		Setpgid: true, // Detach from the parent process group
+	go p.loop()
+	return p
+}
+
+func (p *Player) loop() {
+	events := p.backend.Events()
+	for {
+		select {
+		case command := <-p.commands:
+			command()
+		case e := <-events:
+			station := p.State().Station
+			if e.Station == nil {
+				e.Station = station
+			} else if e.Station != station {
+				// a retry or failure for a station we already left
+				continue
+			}
+			p.update(func(s *State) {
+				switch e.Kind {
+				case SongChanged:
+					s.Song = e.Song
+				case StreamFailed, StreamError, PlaybackStopped:
+					s.Station, s.Song, s.Paused = nil, icy.Title{}, false
+				}
+			})
+			p.bus.Publish(e)
+		case <-p.closed:
+			return
+		}
 	}
-	if err := currentProcess.Start(); err != nil {
-		log.Fatalf("Failed to play station: %v", err)
+}
+
+// do runs command on the player's goroutine and waits for it to finish
+func (p *Player) do(command func() error) error {
+	result := make(chan error, 1)
+	select {
+	case p.commands <- func() { result <- command() }:
+		return <-result
+	case <-p.closed:
+		return ErrClosed
 	}
+}
 
-	go func() {
-		scanner := bufio.NewScanner(stdoutPipe)
-		var inFileTagsSection bool // Tracks if we are in the "File tags" section
-		for scanner.Scan() {
-			line := scanner.Text()
-			// fmt.Printf("\rmpv output: %s\n> ", line) // Debugging raw mpv output
+func (p *Player) update(change func(*State)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	change(&p.state)
+}
 
-			// Detect the start of the "File tags" section
-			if strings.HasPrefix(line, "File tags:") {
-				inFileTagsSection = true
-				continue
-			}
+// Play stops whatever is playing and starts the station
+func (p *Player) Play(station *api.Station) error {
+	return p.do(func() error {
+		p.update(func(s *State) { s.Station, s.Song, s.Paused = nil, icy.Title{}, false })
+		if err := p.backend.Play(station); err != nil {
+			return err
+		}
+		p.update(func(s *State) { s.Station = station })
+		p.bus.Publish(Event{Kind: StationStarted, Station: station})
+		return nil
+	})
+}
 
-			// Parse metadata inside the "File tags" section
-			if inFileTagsSection {
-				if strings.TrimSpace(line) == "" {
-					// End of "File tags" section
-					inFileTagsSection = false
-					continue
-				}
+// Stop ends playback, publishing PlaybackStopped if a station was playing
+func (p *Player) Stop() error {
+	return p.do(func() error {
+		station := p.State().Station
+		p.update(func(s *State) { s.Station, s.Song, s.Paused = nil, icy.Title{}, false })
+		err := p.backend.Stop()
+		if station != nil {
+			p.bus.Publish(Event{Kind: PlaybackStopped, Station: station})
+		}
+		return err
+	})
+}
 
-				// Check if the line contains "icy-title"
-				if strings.Contains(line, "icy-title") {
-					parts := strings.SplitN(line, ": ", 2)
-					if len(parts) == 2 {
-						songInfo := strings.TrimSpace(parts[1])
-						if songInfo == "" || songInfo == "-" {
-							songInfo = "Song unavailable"
-							updateCurrentSong(songInfo)
-							fmt.Printf("\rNow playing: %s\n> ", songInfo)
-							return
-						}
-						updateCurrentSong(songInfo) // Update the current song
-						fmt.Printf("\rNow playing: %s\n> ", songInfo)
-					}
-				}
-			}
+func (p *Player) Pause(paused bool) error {
+	return p.do(func() error {
+		if err := p.backend.Pause(paused); err != nil {
+			return err
 		}
+		p.update(func(s *State) { s.Paused = paused })
+		return nil
+	})
+}
+
+// SetVolume takes a percentage from 0 to 100. Backends that can't change it mid-stream
+// return an error wrapping errors.ErrUnsupported but still use it for the next station.
+func (p *Player) SetVolume(percent int) error {
+	return p.do(func() error {
+		err := p.backend.SetVolume(percent)
+		if err == nil || errors.Is(err, errors.ErrUnsupported) {
+			p.update(func(s *State) { s.Volume = percent })
+		}
+		return err
+	})
+}
 
-		if err := scanner.Err(); err != nil {
-			fmt.Printf("Error reading metadata: %v\n", err)
+// SetEQ switches to one of EQPresets, see SetVolume for backends that can't do it live
+func (p *Player) SetEQ(preset string) error {
+	return p.do(func() error {
+		err := p.backend.SetEQ(preset)
+		if err == nil || errors.Is(err, errors.ErrUnsupported) {
+			p.update(func(s *State) { s.EQ = strings.ToLower(preset) })
 		}
-	}()
-
-	go func() {
-		err := currentProcess.Wait()
-		if err != nil {
-			// Suppress the "signal: killed" message when the process is intentionally stopped
-			if exitError, ok := err.(*exec.ExitError); ok && exitError.ProcessState != nil && exitError.ProcessState.ExitCode() == -1 {
-				// -1 indicates the process was killed (signal SIGKILL)
-				return
+		return err
+	})
+}
+
+// Fade turns the volume from one level to another over d. Backends that can't change
+// volume mid-stream just wait it out. A cancelled ctx stops it where it is.
+func (p *Player) Fade(ctx context.Context, from, to int, d time.Duration) error {
+	steps := max(1, int(d/fadeStep))
+	tick := time.NewTicker(d / time.Duration(steps))
+	defer tick.Stop()
+	for i := 0; i <= steps; i++ {
+		if i > 0 {
+			select {
+			case <-tick.C:
+			case <-ctx.Done():
+				return ctx.Err()
 			}
-			fmt.Printf("Playback finished with error: %v\n", err)
-		} else {
-			fmt.Println("Playback finished.")
 		}
-	}()
+		err := p.SetVolume(from + (to-from)*i/steps)
+		if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rewind goes back d from what's playing now, as far as the time-shift buffer reaches
+func (p *Player) Rewind(d time.Duration) error {
+	return p.do(func() error {
+		if p.shift == nil {
+			return ErrNoTimeShift
+		}
+		if err := p.shift.Rewind(d); err != nil {
+			return err
+		}
+		p.update(func(s *State) { s.Paused = false })
+		return nil
+	})
 }
 
-func StopPlayback() {
-	if currentProcess != nil {
-		// Send a SIGKILL to the current process group
-		err := syscall.Kill(-currentProcess.Process.Pid, syscall.SIGKILL)
-		if err != nil {
-			fmt.Printf("Failed to stop playback: %v\n", err)
-		} else {
-			fmt.Println("Stopped current playback.")
+// Live catches up with the live stream after a rewind or pause
+func (p *Player) Live() error {
+	return p.do(func() error {
+		if p.shift == nil {
+			return ErrNoTimeShift
+		}
+		if err := p.shift.Live(); err != nil {
+			return err
 		}
+		p.update(func(s *State) { s.Paused = false })
+		return nil
+	})
+}
+
+// Behind is how far playback is behind the live stream and how far back it can rewind
+func (p *Player) Behind() (behind, reach time.Duration) {
+	if p.shift == nil {
+		return 0, 0
+	}
+	return p.shift.Behind()
+}
 
-		currentProcess = nil
+// Clip returns the last d of what's playing, straight from the time-shift buffer, so song
+// recognition doesn't have to record from the speakers
+func (p *Player) Clip(d time.Duration) ([]byte, error) {
+	if p.shift == nil {
+		return nil, ErrNoTimeShift
 	}
+	return p.shift.Clip(d)
 }
 
-func GetCurrentSong() string {
-	playbackMutex.Lock()
-	defer playbackMutex.Unlock()
-	return CurrentSong
+// Subscribe delivers the player's events of the given kinds, or all of them when none are
+// given, until the subscription or the player is closed
+func (p *Player) Subscribe(kinds ...EventKind) *Subscription {
+	return p.bus.Subscribe(kinds...)
 }
 
-func updateCurrentSong(song string) {
-	playbackMutex.Lock()
-	defer playbackMutex.Unlock()
-	CurrentSong = song
+// Publish hands subscribers an event from outside playback, like SongAdded or SongDetected
+func (p *Player) Publish(e Event) {
+	p.bus.Publish(e)
+}
+
+func (p *Player) State() State {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// Close stops playback and the player's goroutine and ends every subscription. Calls
+// after that return ErrClosed.
+func (p *Player) Close() error {
+	err := p.Stop()
+	if errors.Is(err, ErrClosed) {
+		return nil
+	}
+	p.close.Do(func() {
+		close(p.closed)
+		p.bus.Close()
+	})
+	return err
 }
@@ -0,0 +1,176 @@
+package playback
+
+import (
+	"cli-radio/api"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPlayerTracksState(t *testing.T) {
+	fake := NewFake()
+	p := NewPlayer(fake)
+	defer p.Close()
+	songs := p.Subscribe(SongChanged, StreamFailed)
+	station := &api.Station{Name: "Jazz FM", URL: "http://example.com/jazz"}
+
+	if err := p.Play(station); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	fake.Emit(Event{Kind: SongChanged, Title: "Nina Simone - Sinnerman"})
+	if e := receive(t, songs); e.Song.Artist != "Nina Simone" || e.Station != station {
+		t.Fatalf("event = %+v", e)
+	}
+	p.Pause(true)
+	p.SetVolume(40)
+	p.SetEQ("Night")
+
+	state := p.State()
+	if state.Station != station || state.Song.Title != "Sinnerman" || !state.Paused || state.Volume != 40 || state.EQ != "night" {
+		t.Errorf("state = %+v", state)
+	}
+
+	// a new station forgets the old song
+	p.Play(&api.Station{Name: "Talk FM", URL: "http://example.com/talk"})
+	if state := p.State(); state.Song.Raw != "" || state.Paused || state.Station.Name != "Talk FM" {
+		t.Errorf("after switching, state = %+v", state)
+	}
+
+	fake.Emit(Event{Kind: StreamFailed, Err: errors.New("gone")})
+	receive(t, songs)
+	if state := p.State(); state.Station != nil {
+		t.Errorf("after failing, state = %+v", state)
+	}
+
+	fake.mu.Lock()
+	fake.PlayErr = errors.New("no route to host")
+	fake.mu.Unlock()
+	if err := p.Play(station); err == nil || p.State().Station != nil {
+		t.Errorf("failed Play = %v, state %+v", err, p.State())
+	}
+}
+
+func TestPlayerPublishes(t *testing.T) {
+	fake := NewFake()
+	p := NewPlayer(fake)
+	defer p.Close()
+	all := p.Subscribe()
+	a := &api.Station{Name: "A", URL: "http://example.com/a"}
+	b := &api.Station{Name: "B", URL: "http://example.com/b"}
+
+	var got []string
+	next := func() {
+		e := receive(t, all)
+		name := "-"
+		if e.Station != nil {
+			name = e.Station.Name
+		}
+		got = append(got, e.Kind.String()+" "+name)
+	}
+
+	p.Play(a)
+	next()
+	p.Play(b)
+	next()
+	// a failure for the station we just left is old news
+	fake.Emit(Event{Kind: StreamFailed, Station: a})
+	fake.Emit(Event{Kind: SongChanged, Title: "Moby - Porcelain"})
+	next()
+	p.Publish(Event{Kind: SongAdded, Title: "Moby - Porcelain"})
+	next()
+	p.Stop()
+	next()
+
+	want := []string{"station_started A", "station_started B", "song_changed B", "song_added -", "playback_stopped B"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+func TestPlayerClose(t *testing.T) {
+	fake := NewFake()
+	p := NewPlayer(fake)
+	p.Play(&api.Station{Name: "A", URL: "http://example.com/a"})
+	if err := p.Rewind(time.Minute); !errors.Is(err, ErrNoTimeShift) {
+		t.Errorf("Rewind without time-shift = %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if fake.Playing {
+		t.Error("Close should stop playback")
+	}
+	if err := p.Play(&api.Station{Name: "B", URL: "http://example.com/b"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Play after Close = %v, want ErrClosed", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+	if _, ok := <-p.Subscribe().Events(); ok {
+		t.Error("subscribing after Close should get a closed channel")
+	}
+}
+
+// fakeFFplay puts an "ffplay" on PATH that just sleeps, so the real runner has a process to manage
+func fakeFFplay(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\nexec sleep 30\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffplay"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestPlayerConcurrentCommands(t *testing.T) {
+	fakeFFplay(t)
+	ffplay := NewFFplay()
+	p := NewPlayer(ffplay)
+	stations := []*api.Station{
+		{Name: "A", URL: "http://example.com/a"},
+		{Name: "B", URL: "http://example.com/b"},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				switch (i + j) % 5 {
+				case 0:
+					p.Play(stations[j%2])
+				case 1:
+					p.Stop()
+				case 2:
+					p.Pause(j%2 == 0)
+				case 3:
+					p.SetVolume(j * 10)
+				case 4:
+					p.State()
+				}
+			}
+		}(i)
+	}
+	// what the signal handler does, in the middle of everything else
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(5 * time.Millisecond)
+		p.Stop()
+	}()
+	wg.Wait()
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if ffplay.run.running() {
+		t.Error("a player process outlived Close")
+	}
+	if p.State().Station != nil {
+		t.Errorf("state after Close = %+v", p.State())
+	}
+}
@@ -0,0 +1,162 @@
+package playback
+
+import (
+	"cli-radio/api"
+	"cli-radio/icy"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type EventKind int
+
+const (
+	// SongChanged carries a new title read from the stream
+	SongChanged EventKind = iota
+	// StreamError means the player died on its own
+	StreamError
+	// PlaybackStopped means playback ended, because we stopped it or the stream ended cleanly
+	PlaybackStopped
+	// Reconnecting means the stream dropped and will be retried after Delay
+	Reconnecting
+	// StreamFailed means the station kept dropping and we gave up on it
+	StreamFailed
+	// StationStarted means a station is now playing
+	StationStarted
+	// SongAdded carries the title of a song saved to the playlist
+	SongAdded
+	// SongDetected carries the title of a song identified with Shazam
+	SongDetected
+	// SongRecorded means a track was saved to Path
+	SongRecorded
+	// RecordingStopped means the recorder is done, Err says why if it wasn't asked to stop
+	RecordingStopped
+	// DeadAir means the station went quiet, stopped playing songs or went to an ad break, see Reason
+	DeadAir
+)
+
+var eventKindNames = []string{"song_changed", "stream_error", "playback_stopped", "reconnecting", "stream_failed", "station_started", "song_added", "song_detected",
+	"song_recorded", "recording_stopped", "dead_air"}
+
+func (k EventKind) String() string {
+	if k < 0 || int(k) >= len(eventKindNames) {
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+	return eventKindNames[k]
+}
+
+type Event struct {
+	Kind  EventKind
+	Title string
+	// Song is Title split into artist and title, or marked as an ad, slogan or placeholder
+	Song icy.Title
+	Err  error
+
+	// the station the event is about, when there is one
+	Station *api.Station
+
+	// set on Reconnecting
+	Attempt int
+	Retries int
+	Delay   time.Duration
+
+	// set on SongRecorded
+	Path string
+
+	// set on DeadAir
+	Reason DeadAirReason
+}
+
+// Backend is something that can play a radio stream: mpv, ffplay or a fake for tests
+type Backend interface {
+	// Play stops whatever is playing and starts the new station
+	Play(station *api.Station) error
+	Stop() error
+	Pause(paused bool) error
+	// SetVolume takes a percentage from 0 to 100
+	SetVolume(percent int) error
+	// SetEQ switches to one of EQPresets, live if the backend can rebuild its filters mid-stream
+	SetEQ(preset string) error
+	// Events delivers song changes and playback failures
+	Events() <-chan Event
+}
+
+// Options picks and configures the player backend
+type Options struct {
+	Backend string `json:"backend"` // mpv (default), ffplay or fake
+	// ICYTitles reads song titles from the stream in Go instead of relying on the backend
+	ICYTitles bool             `json:"icy_titles"`
+	Filters   FilterOptions    `json:"filters"`
+	Reconnect ReconnectOptions `json:"reconnect"`
+	Record    RecordOptions    `json:"record"`
+	TimeShift TimeShiftOptions `json:"timeshift"`
+	DeadAir   DeadAirOptions   `json:"dead_air"`
+}
+
+// New creates a Player on the backend named in the options
+func New(opts Options) (*Player, error) {
+	backend, shift, err := newBackend(opts)
+	if err != nil {
+		return nil, err
+	}
+	p := NewPlayer(backend)
+	p.shift = shift
+	p.update(func(s *State) { s.EQ = opts.Filters.Preset() })
+	return p, nil
+}
+
+// NewBackend creates the backend named in the options, wrapped for ICY titles or
+// time-shift, reconnects and dead air
+func NewBackend(opts Options) (Backend, error) {
+	backend, _, err := newBackend(opts)
+	return backend, err
+}
+
+// newBackend also returns the time-shift buffer, nil when it's off
+func newBackend(opts Options) (Backend, *timeShift, error) {
+	filters, err := opts.Filters.withDefaults()
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad player.filters: %w", err)
+	}
+	if opts.TimeShift.Minutes < 0 {
+		return nil, nil, fmt.Errorf("bad player.timeshift: minutes can't be negative, got %v", opts.TimeShift.Minutes)
+	}
+	patterns, err := opts.DeadAir.compile()
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad player.dead_air: %w", err)
+	}
+	var p Backend
+	switch strings.ToLower(opts.Backend) {
+	case "", "mpv":
+		m := NewMPV()
+		m.run.filters = filters
+		p = m
+	case "ffplay":
+		f := NewFFplay()
+		f.run.filters = filters
+		p = f
+	case "fake":
+		f := NewFake()
+		f.EQ = filters.EQ
+		p = f
+	default:
+		return nil, nil, fmt.Errorf("unknown player backend %q (want mpv, ffplay or fake)", opts.Backend)
+	}
+	var shift *timeShift
+	if opts.TimeShift.Minutes > 0 {
+		// reads titles from the stream itself, so ICYTitles would only be a second connection
+		shift = withTimeShift(p, opts.TimeShift)
+		p = shift
+	} else if opts.ICYTitles {
+		p = withICYTitles(p)
+	}
+	if opts.DeadAir.enabled() {
+		p = watchDeadAir(p, opts.DeadAir, patterns)
+	}
+	return supervise(p, opts.Reconnect), shift, nil
+}
+
+// charsetHint tells the title repair which legacy charsets a station is likely to send
+func charsetHint(station *api.Station) icy.Hint {
+	return icy.Hint{CountryCode: station.CountryCode, Languages: station.Languages}
+}
@@ -0,0 +1,188 @@
+package playback
+
+import (
+	"cli-radio/api"
+	"cli-radio/icy"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewBackends(t *testing.T) {
+	for backend, want := range map[string]string{"": "*playback.MPV", "mpv": "*playback.MPV", "FFplay": "*playback.FFplay", "fake": "*playback.Fake"} {
+		player, err := NewBackend(Options{Backend: backend})
+		if err != nil {
+			t.Fatalf("New(%q) failed: %v", backend, err)
+		}
+		if got := typeName(player.(*supervised).Backend); got != want {
+			t.Errorf("New(%q) = %s, want %s", backend, got, want)
+		}
+	}
+	if _, err := New(Options{Backend: "winamp"}); err == nil {
+		t.Error("New should reject unknown backends")
+	}
+}
+
+func TestFilterChain(t *testing.T) {
+	tests := []struct {
+		opts FilterOptions
+		want string
+	}{
+		{FilterOptions{}, "loudnorm=I=-16:TP=-1.5:LRA=11,aresample=44100"},
+		{FilterOptions{Loudness: level(-23), TruePeak: level(-2), Range: level(7)}, "loudnorm=I=-23:TP=-2:LRA=7,aresample=44100"},
+		// 0 dBTP is set, not left out
+		{FilterOptions{TruePeak: level(0)}, "loudnorm=I=-16:TP=0:LRA=11,aresample=44100"},
+		{FilterOptions{Normalize: "dynaudnorm"}, "dynaudnorm"},
+		{FilterOptions{Normalize: "off"}, ""},
+		{FilterOptions{Normalize: "off", EQ: "Voice"}, EQPresets["voice"]},
+		{FilterOptions{EQ: "night"}, EQPresets["night"] + ",loudnorm=I=-16:TP=-1.5:LRA=11,aresample=44100"},
+	}
+	for _, tt := range tests {
+		opts, err := tt.opts.withDefaults()
+		if err != nil {
+			t.Errorf("%+v: %v", tt.opts, err)
+			continue
+		}
+		if got := opts.Chain(); got != tt.want {
+			t.Errorf("%+v: Chain() = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+
+	for _, bad := range []FilterOptions{{Normalize: "compand"}, {Loudness: level(3)}, {Loudness: level(0)}, {TruePeak: level(-20)}, {Range: level(80)}, {EQ: "loud"}} {
+		if _, err := New(Options{Backend: "fake", Filters: bad}); err == nil {
+			t.Errorf("New should reject filters %+v", bad)
+		}
+	}
+}
+
+func TestMissingBinaryIsAnError(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	for _, player := range []Backend{NewMPV(), NewFFplay()} {
+		err := player.Play(&api.Station{Name: "Example", URL: "http://example.com/stream"})
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("%s.Play error = %v, want a not found error", typeName(player), err)
+		}
+	}
+}
+
+func TestRunnerEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		stop   bool
+		want   EventKind
+		quiet  bool
+	}{
+		{name: "clean exit", script: "exit 0", want: PlaybackStopped},
+		{name: "failure", script: "exit 3", want: StreamError},
+		{name: "stopped on purpose", script: "sleep 10", stop: true, quiet: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRunner()
+			if err := r.start(exec.Command("sh", "-c", tt.script), icy.Hint{}, func() {}); err != nil {
+				t.Fatalf("start failed: %v", err)
+			}
+			if tt.stop {
+				if err := r.stop(); err != nil {
+					t.Fatalf("stop failed: %v", err)
+				}
+			}
+
+			select {
+			case e := <-r.events:
+				if tt.quiet {
+					t.Errorf("got event %+v after an intentional stop", e)
+				} else if e.Kind != tt.want {
+					t.Errorf("event = %+v, want kind %v", e, tt.want)
+				}
+			case <-time.After(500 * time.Millisecond):
+				if !tt.quiet {
+					t.Error("no event after the process exited")
+				}
+			}
+		})
+	}
+}
+
+func TestScanFFplayOutput(t *testing.T) {
+	output := "Input #0, mp3, from 'http://example.com/stream':\n  Metadata:\n    icy-br          : 128\n    StreamTitle     : Nina Simone - Sinnerman\n   3.20 M-A:  0.000\r   3.40 M-A:  0.000\r    StreamTitle     : Nina Simone - Sinnerman\n    StreamTitle     : Miles Davis - So What\n"
+	var titles []string
+	scanFFplayOutput(strings.NewReader(output), func(e Event) { titles = append(titles, e.Title) })
+	if len(titles) != 2 || titles[1] != "Miles Davis - So What" {
+		t.Errorf("titles = %q", titles)
+	}
+}
+
+func typeName(v any) string {
+	return fmt.Sprintf("%T", v)
+}
+
+func TestICYTitlesAlongsidePlayer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("icy-metaint", "16")
+		w.Write(make([]byte, 16))
+		block := "StreamTitle='Nina Simone - Sinnerman';"
+		w.Write([]byte{3})
+		w.Write([]byte(block + strings.Repeat("\x00", 48-len(block))))
+		w.Write(make([]byte, 16))
+	}))
+	defer server.Close()
+
+	player, err := NewBackend(Options{Backend: "fake", ICYTitles: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	fake := player.(*supervised).Backend.(*icyTitles).Backend.(*Fake)
+	// titles from the backend itself are ignored in favour of the stream's
+	fake.Emit(Event{Kind: SongChanged, Title: "from the backend"})
+	fake.Emit(Event{Kind: StreamError})
+	select {
+	case e := <-player.Events():
+		if e.Kind != StreamError {
+			t.Fatalf("first event = %+v, want the backend's StreamError", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the backend's StreamError never came through")
+	}
+
+	if err := player.Play(&api.Station{Name: "Fake FM", URL: server.URL}); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	defer player.Stop()
+
+	var kinds []EventKind
+	var title string
+	for title == "" {
+		select {
+		case e := <-player.Events():
+			kinds = append(kinds, e.Kind)
+			if e.Kind == SongChanged {
+				title = e.Title
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no title from the stream, got %v", kinds)
+		}
+	}
+	if title != "Nina Simone - Sinnerman" || len(kinds) != 1 {
+		t.Errorf("events = %v, title = %q", kinds, title)
+	}
+}
+
+func TestTitlesAreRepaired(t *testing.T) {
+	fake := NewFake()
+	if err := fake.Play(&api.Station{Name: "Радио", URL: "http://example.com/stream", CountryCode: "RU"}); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	// "Кино - Кукушка" in Windows-1251
+	go fake.Emit(Event{Kind: SongChanged, Title: "\xca\xe8\xed\xee - \xca\xf3\xea\xf3\xf8\xea\xe0"})
+
+	e := <-fake.Events()
+	if e.Title != "Кино - Кукушка" || e.Song.Artist != "Кино" || e.Song.Title != "Кукушка" {
+		t.Errorf("event = %q %+v", e.Title, e.Song)
+	}
+}
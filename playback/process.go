@@ -0,0 +1,160 @@
+package playback
+
+import (
+	"cli-radio/icy"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const eventBuffer = 32
+
+// process is one running player
+type process struct {
+	cmd     *exec.Cmd
+	stopped bool // set when we killed it on purpose
+}
+
+// runner owns the single player process a backend has at a time and
+// turns its exit into an event.
+type runner struct {
+	mu      sync.Mutex
+	proc    *process
+	volume  int
+	filters FilterOptions
+	charset icy.Hint // used to repair titles from the current station
+	events  chan Event
+}
+
+func newRunner() *runner {
+	return &runner{volume: 100, filters: defaultFilters, events: make(chan Event, eventBuffer)}
+}
+
+// start launches cmd in its own process group. cleanup runs once the process has exited.
+func (r *runner) start(cmd *exec.Cmd, charset icy.Hint, cleanup func()) error {
+	// Detach the process
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true, // Detach from the parent process group
+	}
+	if err := cmd.Start(); err != nil {
+		cleanup()
+		return fmt.Errorf("failed to start %s: %w", cmd.Path, err)
+	}
+
+	p := &process{cmd: cmd}
+	r.mu.Lock()
+	r.proc = p
+	r.charset = charset
+	r.mu.Unlock()
+
+	go func() {
+		err := cmd.Wait()
+		cleanup()
+
+		r.mu.Lock()
+		intentional := p.stopped
+		if r.proc == p {
+			r.proc = nil
+		}
+		r.mu.Unlock()
+
+		switch {
+		case intentional:
+			// we killed it, nothing to report
+		case err != nil:
+			r.emit(Event{Kind: StreamError, Err: err})
+		default:
+			r.emit(Event{Kind: PlaybackStopped})
+		}
+	}()
+	return nil
+}
+
+// stop kills the running process group, if any
+func (r *runner) stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.proc == nil {
+		return nil
+	}
+	p := r.proc
+	p.stopped = true
+	r.proc = nil
+
+	// Send a SIGKILL to the current process group
+	if err := syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		return fmt.Errorf("failed to stop playback: %w", err)
+	}
+	return nil
+}
+
+// pause stops or resumes the whole process group, for backends without a control channel
+func (r *runner) pause(paused bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.proc == nil {
+		return errors.New("nothing playing")
+	}
+	sig := syscall.SIGCONT
+	if paused {
+		sig = syscall.SIGSTOP
+	}
+	return syscall.Kill(-r.proc.cmd.Process.Pid, sig)
+}
+
+// filterChain is the ffmpeg filter graph to start the next stream with
+func (r *runner) filterChain() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.filters.Chain()
+}
+
+// setEQ switches the EQ preset and returns the new filter chain
+func (r *runner) setEQ(preset string) (string, error) {
+	preset = strings.ToLower(preset)
+	if _, ok := EQPresets[preset]; !ok {
+		return "", unknownEQ(preset)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.filters.EQ = preset
+	return r.filters.Chain(), nil
+}
+
+func (r *runner) running() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.proc != nil
+}
+
+func (r *runner) emit(e Event) {
+	r.mu.Lock()
+	charset := r.charset
+	r.mu.Unlock()
+	sendEvent(r.events, e, charset)
+}
+
+// sendEvent hands an event to the listener without ever blocking the player
+func sendEvent(events chan Event, e Event, charset icy.Hint) {
+	forward(events, parseSong(e, charset))
+}
+
+// forward passes on an event that's already been through sendEvent
+func forward(events chan Event, e Event) {
+	select {
+	case events <- e:
+	default:
+	}
+}
+
+// parseSong fills in Song for a title event, first repairing titles sent in a legacy charset
+func parseSong(e Event, charset icy.Hint) Event {
+	if e.Kind == SongChanged {
+		e.Title = icy.Repair(e.Title, charset)
+		e.Song = icy.ParseTitle(e.Title)
+	}
+	return e
+}
@@ -0,0 +1,372 @@
+package playback
+
+import (
+	"cli-radio/api"
+	"cli-radio/icy"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// RecordOptions controls where `rec` saves tracks and how much space it may use
+type RecordOptions struct {
+	Dir string `json:"dir"`
+	// QuotaMB caps everything under Dir, recording stops once it's reached. -1 for no limit.
+	QuotaMB int `json:"quota_mb"`
+}
+
+const (
+	defaultRecordDir   = "recordings"
+	defaultRecordQuota = 2048
+	// long titles make for unwieldy file names, and some filesystems cap them at 255 bytes
+	maxFileName = 120
+)
+
+var ErrQuota = errors.New("recording quota reached")
+
+// Recorder saves a station's stream to disk, one file per song. It reads the stream over
+// its own connection so the split points line up exactly with the title changes.
+type Recorder struct {
+	client  *http.Client
+	dir     string
+	quota   int64 // bytes, < 0 for no limit
+	publish func(Event)
+	now     func() time.Time
+
+	mu      sync.Mutex
+	station *api.Station
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewRecorder reports saved tracks as SongRecorded and the end of a recording as
+// RecordingStopped through publish, which is usually Player.Publish
+func NewRecorder(opts RecordOptions, publish func(Event)) *Recorder {
+	r := &Recorder{
+		client:  icy.NewClient(),
+		dir:     opts.Dir,
+		quota:   int64(opts.QuotaMB) << 20,
+		publish: publish,
+		now:     time.Now,
+	}
+	if r.dir == "" {
+		r.dir = defaultRecordDir
+	}
+	if opts.QuotaMB == 0 {
+		r.quota = defaultRecordQuota << 20
+	}
+	return r
+}
+
+// Dir is where recordings go, one folder per station
+func (r *Recorder) Dir() string {
+	return r.dir
+}
+
+// Station is what's being recorded, nil when nothing is
+func (r *Recorder) Station() *api.Station {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.station
+}
+
+// Start stops any recording in progress and starts on station. The song that's playing
+// when it connects is only partly there, so the first file starts at the next title change.
+func (r *Recorder) Start(station *api.Station) error {
+	r.Stop()
+
+	used, err := diskUsage(r.dir)
+	if err != nil {
+		return fmt.Errorf("failed to check recordings folder: %w", err)
+	}
+	if r.quota >= 0 && used >= r.quota {
+		return fmt.Errorf("%w: %s already holds %d MB", ErrQuota, r.dir, used>>20)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := &recording{
+		station: station,
+		dir:     filepath.Join(r.dir, fileName(station.Name)),
+		charset: charsetHint(station),
+		left:    r.quota - used,
+		limited: r.quota >= 0,
+		publish: r.publish,
+		now:     r.now,
+	}
+	// the icy client gives up on a station that never answers, so this can't hold up the prompt
+	stream, err := icy.Open(ctx, r.client, station.StreamURL(), rec.metadata)
+	if err != nil {
+		cancel()
+		return err
+	}
+	if err := os.MkdirAll(rec.dir, 0755); err != nil {
+		cancel()
+		stream.Close()
+		return fmt.Errorf("failed to create recordings folder: %w", err)
+	}
+	rec.setFormat(stream.Headers)
+
+	done := make(chan struct{})
+	r.mu.Lock()
+	r.station, r.cancel, r.done = station, cancel, done
+	r.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		defer stream.Close()
+		err := rec.run(stream)
+		if ctx.Err() != nil {
+			// stopped on purpose
+			err = nil
+		}
+		r.mu.Lock()
+		if r.done == done {
+			r.station, r.cancel, r.done = nil, nil, nil
+		}
+		r.mu.Unlock()
+		r.publish(Event{Kind: RecordingStopped, Station: station, Err: err})
+	}()
+	return nil
+}
+
+// Stop ends the recording, keeping the track in progress, and waits for it to be saved
+func (r *Recorder) Stop() {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// recording is one run of the recorder, everything on it is used from the goroutine
+// reading the stream
+type recording struct {
+	station *api.Station
+	dir     string
+	charset icy.Hint
+	ext     string
+	tagged  bool // whether the format can carry an ID3 tag
+	left    int64
+	limited bool
+	publish func(Event)
+	now     func() time.Time
+
+	titled bool // whether the stream has sent a title yet
+	last   string
+	track  *track // nil while skipping audio
+	err    error  // set by metadata, which can't return one
+}
+
+// track is a file being written, under a temporary name until it's complete
+type track struct {
+	file *os.File
+	song icy.Title
+	name string
+}
+
+func (rec *recording) setFormat(h icy.Headers) {
+	format := strings.ToLower(h.ContentType)
+	if format == "" {
+		format = strings.ToLower(rec.station.Codec)
+	}
+	switch {
+	case strings.Contains(format, "mpeg"), format == "mp3":
+		rec.ext, rec.tagged = ".mp3", true
+	case strings.Contains(format, "aac"):
+		rec.ext, rec.tagged = ".aac", true
+	case strings.Contains(format, "ogg"):
+		rec.ext = ".ogg"
+	case strings.Contains(format, "opus"):
+		rec.ext = ".opus"
+	case strings.Contains(format, "flac"):
+		rec.ext = ".flac"
+	default:
+		rec.ext = ".audio"
+	}
+	if h.MetaInt == 0 {
+		// no titles to split on, so the whole thing is one file from the start
+		rec.titled = true
+		rec.begin(icy.Title{})
+	}
+}
+
+func (rec *recording) run(stream *icy.Stream) error {
+	_, err := io.Copy(rec, stream.Body)
+	if rec.err != nil {
+		err = rec.err
+	}
+	if errors.Is(err, ErrQuota) {
+		rec.discard()
+		return err
+	}
+	if finishErr := rec.finish(); err == nil {
+		err = finishErr
+	}
+	return err
+}
+
+// metadata splits the recording whenever the title changes
+func (rec *recording) metadata(m icy.Metadata) {
+	title := strings.TrimSpace(m.StreamTitle)
+	if rec.err != nil || (rec.titled && title == rec.last) {
+		return
+	}
+	first := !rec.titled
+	rec.titled, rec.last = true, title
+	if first {
+		// we joined halfway through this one
+		return
+	}
+	if err := rec.finish(); err != nil {
+		rec.err = err
+		return
+	}
+	song := parseSong(Event{Kind: SongChanged, Title: title}, rec.charset).Song
+	if song.Kind == icy.Ad {
+		return
+	}
+	rec.begin(song)
+}
+
+// Write saves audio to the current track, or drops it while there isn't one
+func (rec *recording) Write(p []byte) (int, error) {
+	if rec.err != nil {
+		return 0, rec.err
+	}
+	if rec.track == nil {
+		return len(p), nil
+	}
+	if rec.limited && int64(len(p)) > rec.left {
+		return 0, ErrQuota
+	}
+	n, err := rec.track.file.Write(p)
+	rec.left -= int64(n)
+	return n, err
+}
+
+func (rec *recording) begin(song icy.Title) {
+	name := song.String()
+	if name == "" {
+		name = fmt.Sprintf("%s %s", rec.station.Name, rec.now().Format("2006-01-02 15.04"))
+	}
+	file, err := os.CreateTemp(rec.dir, ".rec-*"+rec.ext)
+	if err != nil {
+		rec.err = fmt.Errorf("failed to create recording: %w", err)
+		return
+	}
+	rec.track = &track{file: file, song: song, name: fileName(name)}
+	if rec.tagged {
+		tags := id3Tags{
+			Title:   song.Title,
+			Artist:  song.Artist,
+			Album:   song.Album,
+			Station: rec.station.Name,
+			Comment: "Recorded " + rec.now().Format("2006-01-02 15:04"),
+		}
+		if !song.IsSong() {
+			tags.Title = name
+		}
+		if _, err := rec.Write(id3v2(tags)); err != nil {
+			rec.err = err
+		}
+	}
+}
+
+// finish gives the current track its real name
+func (rec *recording) finish() error {
+	t := rec.track
+	if t == nil {
+		return nil
+	}
+	rec.track = nil
+	if err := t.file.Close(); err != nil {
+		os.Remove(t.file.Name())
+		return fmt.Errorf("failed to save recording: %w", err)
+	}
+	path := uniquePath(filepath.Join(rec.dir, t.name), rec.ext)
+	if err := os.Rename(t.file.Name(), path); err != nil {
+		os.Remove(t.file.Name())
+		return fmt.Errorf("failed to save recording: %w", err)
+	}
+	rec.publish(Event{Kind: SongRecorded, Station: rec.station, Song: t.song, Title: t.song.Raw, Path: path})
+	return nil
+}
+
+// discard throws away the track in progress
+func (rec *recording) discard() {
+	if t := rec.track; t != nil {
+		rec.track = nil
+		t.file.Close()
+		os.Remove(t.file.Name())
+	}
+}
+
+// uniquePath adds " (2)", " (3)"... when a song is recorded more than once
+func uniquePath(base, ext string) string {
+	path := base + ext
+	for i := 2; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return path
+		}
+		path = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// fileName makes a title safe to use as a file name everywhere
+func fileName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.Trim(strings.TrimSpace(s), ".")
+	if len(s) > maxFileName {
+		s = s[:maxFileName]
+		// don't leave half a character behind
+		for len(s) > 0 && !utf8.ValidString(s) {
+			s = s[:len(s)-1]
+		}
+	}
+	if s == "" {
+		return "untitled"
+	}
+	return s
+}
+
+// diskUsage adds up the size of every file under dir
+func diskUsage(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,197 @@
+package playback
+
+import (
+	"bytes"
+	"cli-radio/api"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testMetaint = 1000
+
+// streamServer sends one chunk of audio per title with a metadata block after each, then
+// ends the stream. Chunk i is filled with the byte 'a'+i.
+func streamServer(titles ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("icy-metaint", fmt.Sprint(testMetaint))
+		for i, title := range titles {
+			w.Write(bytes.Repeat([]byte{byte('a' + i)}, testMetaint))
+			w.Write(metadata(title))
+		}
+	}))
+}
+
+// metadata encodes an ICY metadata block carrying title
+func metadata(title string) []byte {
+	text := fmt.Sprintf("StreamTitle='%s';", title)
+	blocks := (len(text) + 15) / 16
+	block := make([]byte, 1+blocks*16)
+	block[0] = byte(blocks)
+	copy(block[1:], text)
+	return block
+}
+
+func record(t *testing.T, opts RecordOptions, url string) []Event {
+	t.Helper()
+	events := make(chan Event, 16)
+	r := NewRecorder(opts, func(e Event) { events <- e })
+	if err := r.Start(&api.Station{Name: "Late/Night FM", URL: url}); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	var got []Event
+	for {
+		select {
+		case e := <-events:
+			got = append(got, e)
+			if e.Kind == RecordingStopped {
+				return got
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("recording never stopped")
+		}
+	}
+}
+
+func TestRecorderSplitsBySong(t *testing.T) {
+	// the title comes after its first chunk, so chunk i+1 is the start of titles[i]
+	server := streamServer("Joined - Halfway", "Joined - Halfway", "Moodymann - Shades of Jae", "Commercial Break - Back Soon", "Larry Heard - Can You Feel It", "Moodymann - Shades of Jae")
+	defer server.Close()
+	dir := t.TempDir()
+
+	events := record(t, RecordOptions{Dir: dir}, server.URL)
+	if last := events[len(events)-1]; last.Err != nil {
+		t.Fatalf("recording stopped with %v", last.Err)
+	}
+
+	var saved []string
+	for _, e := range events[:len(events)-1] {
+		if e.Kind != SongRecorded {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		saved = append(saved, filepath.Base(e.Path))
+	}
+	want := []string{"Moodymann - Shades of Jae.mp3", "Larry Heard - Can You Feel It.mp3", "Moodymann - Shades of Jae (2).mp3"}
+	if fmt.Sprint(saved) != fmt.Sprint(want) {
+		t.Errorf("saved %q, want %q", saved, want)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "Late_Night FM", "*"))
+	if len(files) != 3 {
+		t.Fatalf("files = %v, want only the finished tracks", files)
+	}
+
+	data, err := os.ReadFile(events[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("ID3\x03")) {
+		t.Fatalf("no ID3 tag at the start of %s", events[0].Path)
+	}
+	// a 10 byte header, then the frames
+	end := 10 + (int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9]))
+	tag, audio := data[:end], data[end:]
+	if !bytes.Equal(audio, bytes.Repeat([]byte{'d'}, testMetaint)) {
+		t.Errorf("first track holds %d bytes of audio starting with %q, want the 4th chunk", len(audio), audio[:1])
+	}
+	for _, text := range []string{"Moodymann", "Shades of Jae", "Late/Night FM"} {
+		if encoded := utf16Text(text); !bytes.Contains(tag, encoded[2:len(encoded)-2]) {
+			t.Errorf("tag is missing %q", text)
+		}
+	}
+}
+
+func TestRecorderQuota(t *testing.T) {
+	server := streamServer("A - One", "B - Two", "C - Three", "D - Four", "E - Five")
+	defer server.Close()
+	dir := t.TempDir()
+	// room for a bit over two tracks
+	os.WriteFile(filepath.Join(dir, "filler"), make([]byte, 1<<20-2500), 0644)
+
+	events := record(t, RecordOptions{Dir: dir, QuotaMB: 1}, server.URL)
+	last := events[len(events)-1]
+	if !errors.Is(last.Err, ErrQuota) {
+		t.Fatalf("recording stopped with %v, want ErrQuota", last.Err)
+	}
+	if len(events) != 3 {
+		t.Errorf("got %d events, want 2 tracks saved before the quota", len(events))
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "Late_Night FM", "*"))
+	if len(files) != 2 {
+		t.Errorf("files = %v, the unfinished track should be removed", files)
+	}
+
+	os.WriteFile(filepath.Join(dir, "more filler"), make([]byte, 2500), 0644)
+	r := NewRecorder(RecordOptions{Dir: dir, QuotaMB: 1}, func(Event) {})
+	if err := r.Start(&api.Station{Name: "A", URL: server.URL}); !errors.Is(err, ErrQuota) {
+		t.Errorf("Start on a full folder = %v, want ErrQuota", err)
+	}
+}
+
+// stalledServer takes connections and never answers, returning its URL
+func stalledServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				break
+			}
+			conns = append(conns, conn)
+		}
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	return "http://" + listener.Addr().String()
+}
+
+// impatient shortens how long an icy client waits for headers, ten seconds is a long test
+func impatient(client *http.Client) {
+	client.Transport.(*http.Transport).ResponseHeaderTimeout = 100 * time.Millisecond
+}
+
+func TestRecorderStalledStation(t *testing.T) {
+	r := NewRecorder(RecordOptions{Dir: t.TempDir()}, func(Event) {})
+	impatient(r.client)
+	started := make(chan error, 1)
+	go func() { started <- r.Start(&api.Station{Name: "Silent Treatment FM", URL: stalledServer(t)}) }()
+	select {
+	case err := <-started:
+		if err == nil {
+			t.Error("Start succeeded without any headers")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start is still waiting on the station")
+	}
+	if r.Station() != nil {
+		t.Errorf("recording %v after failing to start", r.Station())
+	}
+	r.Stop()
+}
+
+func TestFileName(t *testing.T) {
+	tests := map[string]string{
+		"AC/DC - T.N.T.":           "AC_DC - T.N.T",
+		"  What? <Live>  ":         "What_ _Live_",
+		"...":                      "untitled",
+		"Sigur Rós - Hoppípolla\n": "Sigur Rós - Hoppípolla",
+	}
+	for in, want := range tests {
+		if got := fileName(in); got != want {
+			t.Errorf("fileName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package playback
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// ring holds the last few minutes of a stream. Positions are absolute byte offsets from
+// the start of the stream, so readers can keep their place while old audio falls off.
+type ring struct {
+	mu     sync.Mutex
+	data   []byte
+	start  int64 // oldest byte still held
+	end    int64 // the live edge
+	rate   int   // bytes per second of audio
+	titles []titleMark
+	err    error         // why the stream ended, set once it has
+	grew   chan struct{} // closed and replaced whenever data arrives or the stream ends
+}
+
+// titleMark is where a title starts in the stream
+type titleMark struct {
+	offset int64
+	title  string
+}
+
+func newRing(size, rate int) *ring {
+	return &ring{data: make([]byte, size), rate: rate, grew: make(chan struct{})}
+}
+
+// Write appends audio at the live edge, dropping the oldest audio once the ring is full
+func (r *ring) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(p)
+	if len(p) > len(r.data) {
+		r.end += int64(len(p) - len(r.data))
+		p = p[len(p)-len(r.data):]
+	}
+	for len(p) > 0 {
+		i := int(r.end % int64(len(r.data)))
+		copied := copy(r.data[i:], p)
+		p = p[copied:]
+		r.end += int64(copied)
+	}
+	if oldest := r.end - int64(len(r.data)); oldest > r.start {
+		r.start = oldest
+		// keep the title that was on at the new start
+		for len(r.titles) > 1 && r.titles[1].offset <= r.start {
+			r.titles = r.titles[1:]
+		}
+	}
+	r.notify()
+	return n, nil
+}
+
+// mark records a title change at the live edge
+func (r *ring) mark(title string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.titles = append(r.titles, titleMark{offset: r.end, title: title})
+}
+
+// close ends the stream, readers get err (io.EOF if nil) once they catch up
+func (r *ring) close(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	r.err = err
+	r.notify()
+}
+
+func (r *ring) notify() {
+	close(r.grew)
+	r.grew = make(chan struct{})
+}
+
+// readAt copies audio from pos into p, waiting at the live edge for more. If pos has
+// already fallen off the ring it reads from the oldest audio instead, and returns where
+// the copied bytes actually came from.
+func (r *ring) readAt(ctx context.Context, pos int64, p []byte) (int, int64, error) {
+	for {
+		r.mu.Lock()
+		pos = r.clamp(pos)
+		if pos < r.end {
+			i := int(pos % int64(len(r.data)))
+			n := copy(p, r.data[i:min(len(r.data), i+int(r.end-pos))])
+			r.mu.Unlock()
+			return n, pos, nil
+		}
+		err, grew := r.err, r.grew
+		r.mu.Unlock()
+		if err != nil {
+			return 0, pos, err
+		}
+		select {
+		case <-grew:
+		case <-ctx.Done():
+			return 0, pos, ctx.Err()
+		}
+	}
+}
+
+// slice copies out the audio between from and to, as much of it as the ring still holds
+func (r *ring) slice(from, to int64) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	from, to = r.clamp(from), r.clamp(to)
+	out := make([]byte, 0, to-from)
+	for from < to {
+		i := int(from % int64(len(r.data)))
+		chunk := r.data[i:min(len(r.data), i+int(to-from))]
+		out = append(out, chunk...)
+		from += int64(len(chunk))
+	}
+	return out
+}
+
+// titleAt is the title that was on at pos
+func (r *ring) titleAt(pos int64) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.titles) - 1; i >= 0; i-- {
+		if r.titles[i].offset <= pos {
+			return r.titles[i].title, true
+		}
+	}
+	return "", false
+}
+
+// nextTitle is where the first title change after pos is
+func (r *ring) nextTitle(pos int64) (int64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.titles {
+		if m.offset > pos {
+			return m.offset, true
+		}
+	}
+	return 0, false
+}
+
+// edges returns the oldest position held and the live edge
+func (r *ring) edges() (int64, int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.start, r.end
+}
+
+func (r *ring) clamp(pos int64) int64 {
+	return max(r.start, min(pos, r.end))
+}
@@ -7,13 +7,15 @@ import (
 	"syscall"
 )
 
-func HandleSignals(StopPlayback func()) {
+// HandleSignals runs cleanup and exits on Ctrl-C or SIGTERM. os.Exit skips deferred
+// calls, so cleanup has to do everything main would have done on the way out.
+func HandleSignals(cleanup func()) {
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		for sig := range sigs {
 			fmt.Printf("\nReceived signal: %s. Cleaning up...\n", sig)
-			StopPlayback()
+			cleanup()
 			os.Exit(0)
 		}
 	}()
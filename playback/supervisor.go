@@ -0,0 +1,158 @@
+package playback
+
+import (
+	"cli-radio/api"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ReconnectOptions controls what happens when a stream drops
+type ReconnectOptions struct {
+	// Retries is how many times to restart a dropped stream before giving up on the station, -1 for never
+	Retries int `json:"retries"`
+	// BackoffSeconds is the wait before the first retry, doubled after every failed one
+	BackoffSeconds float64 `json:"backoff_seconds"`
+}
+
+const (
+	defaultRetries = 3
+	defaultBackoff = 2 * time.Second
+	maxBackoff     = 30 * time.Second
+	// a stream that stayed up this long is working again, so a later drop starts the retries over
+	stableAfter = time.Minute
+)
+
+// supervised restarts a backend's stream when it drops, with backoff, and reports
+// StreamFailed once it runs out of retries. Stops we asked for are never retried.
+type supervised struct {
+	Backend
+	retries int
+	backoff time.Duration
+	events  chan Event
+	now     func() time.Time
+
+	playMu sync.Mutex // Play, Stop and retries take turns on the backend
+
+	mu         sync.Mutex
+	station    *api.Station // nil when we're not supposed to be playing
+	attempt    int
+	started    time.Time
+	generation int // bumped on Play/Stop so a pending retry for an old station is dropped
+}
+
+// retrier is a backend that wants to know when Play is a retry of a dropped stream rather
+// than the user tuning in
+type retrier interface {
+	Retry(station *api.Station) error
+}
+
+func supervise(p Backend, opts ReconnectOptions) *supervised {
+	s := &supervised{
+		Backend: p,
+		retries: opts.Retries,
+		backoff: time.Duration(opts.BackoffSeconds * float64(time.Second)),
+		events:  make(chan Event, eventBuffer),
+		now:     time.Now,
+	}
+	if s.retries == 0 {
+		s.retries = defaultRetries
+	}
+	if s.backoff <= 0 {
+		s.backoff = defaultBackoff
+	}
+	go func() {
+		for e := range p.Events() {
+			if e.Kind == StreamError || e.Kind == PlaybackStopped {
+				s.dropped(e)
+				continue
+			}
+			forward(s.events, e)
+		}
+	}()
+	return s
+}
+
+func (s *supervised) Play(station *api.Station) error {
+	s.playMu.Lock()
+	defer s.playMu.Unlock()
+
+	s.mu.Lock()
+	s.generation++
+	s.station, s.attempt, s.started = station, 0, s.now()
+	s.mu.Unlock()
+	return s.Backend.Play(station)
+}
+
+func (s *supervised) Stop() error {
+	s.playMu.Lock()
+	defer s.playMu.Unlock()
+
+	s.mu.Lock()
+	s.generation++
+	s.station = nil
+	s.mu.Unlock()
+	return s.Backend.Stop()
+}
+
+func (s *supervised) Events() <-chan Event {
+	return s.events
+}
+
+// dropped decides between another try and giving up on the station
+func (s *supervised) dropped(e Event) {
+	err := e.Err
+	if err == nil {
+		err = errors.New("stream ended")
+	}
+
+	s.mu.Lock()
+	station := s.station
+	if station == nil {
+		// not ours to retry, pass it on as is
+		s.mu.Unlock()
+		forward(s.events, e)
+		return
+	}
+	if s.now().Sub(s.started) >= stableAfter {
+		s.attempt = 0
+	}
+	s.attempt++
+	attempt, generation := s.attempt, s.generation
+	if s.retries < 0 || attempt > s.retries {
+		s.station = nil
+		s.mu.Unlock()
+		forward(s.events, Event{Kind: StreamFailed, Station: station, Err: err})
+		return
+	}
+	s.mu.Unlock()
+
+	delay := s.backoff << (attempt - 1)
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	forward(s.events, Event{Kind: Reconnecting, Station: station, Err: err, Attempt: attempt, Retries: s.retries, Delay: delay})
+	time.AfterFunc(delay, func() { s.retry(generation, station) })
+}
+
+func (s *supervised) retry(generation int, station *api.Station) {
+	s.playMu.Lock()
+	defer s.playMu.Unlock()
+
+	s.mu.Lock()
+	if generation != s.generation {
+		// the user moved on or stopped while we were waiting
+		s.mu.Unlock()
+		return
+	}
+	s.started = s.now()
+	s.mu.Unlock()
+
+	play := s.Backend.Play
+	if r, ok := s.Backend.(retrier); ok {
+		play = r.Retry
+	}
+	if err := play(station); err != nil {
+		s.dropped(Event{Kind: StreamError, Err: err})
+	}
+}
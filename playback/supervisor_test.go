@@ -0,0 +1,140 @@
+package playback
+
+import (
+	"cli-radio/api"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSupervised(retries int) (*supervised, *Fake) {
+	fake := NewFake()
+	return supervise(fake, ReconnectOptions{Retries: retries, BackoffSeconds: 0.01}), fake
+}
+
+func nextEvent(t *testing.T, p Backend) Event {
+	t.Helper()
+	select {
+	case e := <-p.Events():
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event")
+	}
+	return Event{}
+}
+
+func plays(fake *Fake) int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	n := 0
+	for _, c := range fake.Calls {
+		if strings.HasPrefix(c, "play ") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSupervisorReconnects(t *testing.T) {
+	s, fake := newSupervised(2)
+	station := &api.Station{Name: "Flaky FM", URL: "http://example.com/flaky"}
+	if err := s.Play(station); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+
+	fake.Emit(Event{Kind: StreamError, Err: errors.New("connection reset")})
+	e := nextEvent(t, s)
+	if e.Kind != Reconnecting || e.Attempt != 1 || e.Retries != 2 || e.Station != station || e.Err.Error() != "connection reset" {
+		t.Fatalf("first drop = %+v", e)
+	}
+	waitFor(t, "the retry", func() bool { return plays(fake) == 2 })
+
+	// a clean end of a radio stream is a drop too
+	fake.Emit(Event{Kind: PlaybackStopped})
+	if e := nextEvent(t, s); e.Kind != Reconnecting || e.Attempt != 2 || e.Delay != 20*time.Millisecond {
+		t.Fatalf("second drop = %+v", e)
+	}
+	waitFor(t, "the second retry", func() bool { return plays(fake) == 3 })
+
+	fake.Emit(Event{Kind: StreamError, Err: errors.New("gone")})
+	if e := nextEvent(t, s); e.Kind != StreamFailed || e.Station != station {
+		t.Fatalf("third drop = %+v, want StreamFailed", e)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if plays(fake) != 3 {
+		t.Errorf("played %d times after giving up, want 3", plays(fake))
+	}
+}
+
+func TestSupervisorStablePlaybackResetsRetries(t *testing.T) {
+	s, fake := newSupervised(1)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	s.Play(&api.Station{Name: "Mostly Fine FM", URL: "http://example.com/fine"})
+
+	for i := 0; i < 3; i++ {
+		now = now.Add(2 * stableAfter)
+		fake.Emit(Event{Kind: StreamError})
+		if e := nextEvent(t, s); e.Kind != Reconnecting || e.Attempt != 1 {
+			t.Fatalf("drop %d = %+v, want a first retry every time", i, e)
+		}
+		waitFor(t, "the retry", func() bool { return plays(fake) == i+2 })
+	}
+}
+
+func TestSupervisorStopCancelsRetry(t *testing.T) {
+	fake := NewFake()
+	s := supervise(fake, ReconnectOptions{BackoffSeconds: 0.05})
+	s.Play(&api.Station{Name: "A", URL: "http://example.com/a"})
+
+	fake.Emit(Event{Kind: StreamError})
+	if e := nextEvent(t, s); e.Kind != Reconnecting {
+		t.Fatalf("got %+v", e)
+	}
+	s.Stop()
+	time.Sleep(100 * time.Millisecond)
+	if plays(fake) != 1 {
+		t.Errorf("retried after Stop: %v", fake.Calls)
+	}
+
+	// a new station while a retry is pending wins too
+	s.Play(&api.Station{Name: "B", URL: "http://example.com/b"})
+	fake.Emit(Event{Kind: StreamError})
+	nextEvent(t, s)
+	s.Play(&api.Station{Name: "C", URL: "http://example.com/c"})
+	time.Sleep(100 * time.Millisecond)
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.URL != "http://example.com/c" {
+		t.Errorf("playing %s, want C", fake.URL)
+	}
+}
+
+func TestSupervisorFailedRetryCountsAsDrop(t *testing.T) {
+	s, fake := newSupervised(1)
+	station := &api.Station{Name: "Dead FM", URL: "http://example.com/dead"}
+	s.Play(station)
+
+	fake.mu.Lock()
+	fake.PlayErr = errors.New("404 not found")
+	fake.mu.Unlock()
+	fake.Emit(Event{Kind: StreamError})
+
+	if e := nextEvent(t, s); e.Kind != Reconnecting {
+		t.Fatalf("got %+v", e)
+	}
+	e := nextEvent(t, s)
+	if e.Kind != StreamFailed || e.Err.Error() != "404 not found" {
+		t.Errorf("got %+v, want StreamFailed from the retry's error", e)
+	}
+}
+
+func TestSupervisorDisabled(t *testing.T) {
+	s, fake := newSupervised(-1)
+	s.Play(&api.Station{Name: "A", URL: "http://example.com/a"})
+	fake.Emit(Event{Kind: StreamError})
+	if e := nextEvent(t, s); e.Kind != StreamFailed {
+		t.Errorf("got %+v, want StreamFailed straight away", e)
+	}
+}
@@ -0,0 +1,202 @@
+package playback
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TimerKind int
+
+const (
+	// SleepTimer fades out and stops playback
+	SleepTimer TimerKind = iota
+	// AlarmTimer starts playback with a fade-in
+	AlarmTimer
+)
+
+func (k TimerKind) String() string {
+	if k == SleepTimer {
+		return "sleep"
+	}
+	return "alarm"
+}
+
+// Timer is a sleep timer or alarm. It stays listed from when it's set until whatever it
+// started is finished, and cancelling it cancels Context, fades included.
+type Timer struct {
+	ID   int
+	Kind TimerKind
+	// At is when it's done: playback stops or the alarm goes off
+	At time.Time
+	// Fade is how long the fade takes. A sleep timer goes off that long before At.
+	Fade time.Duration
+	// Target is the station or profile an alarm plays, "" for the last station
+	Target string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	timer  *time.Timer
+	fired  bool
+}
+
+func (t *Timer) Context() context.Context {
+	return t.ctx
+}
+
+// Fired reports whether the timer has gone off and is busy fading
+func (t *Timer) Fired() bool {
+	return t.fired
+}
+
+// Timers keeps the timers and delivers each one on Due when it goes off, so the caller can
+// act on it from its own goroutine
+type Timers struct {
+	mu     sync.Mutex
+	next   int
+	timers map[int]*Timer
+	due    chan *Timer
+	now    func() time.Time
+}
+
+func NewTimers() *Timers {
+	return &Timers{next: 1, timers: map[int]*Timer{}, due: make(chan *Timer), now: time.Now}
+}
+
+// Add sets a timer for at. Setting a sleep timer replaces the one already set.
+func (ts *Timers) Add(kind TimerKind, at time.Time, fade time.Duration, target string) *Timer {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if kind == SleepTimer {
+		for _, t := range ts.timers {
+			if t.Kind == SleepTimer {
+				ts.remove(t)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &Timer{ID: ts.next, Kind: kind, At: at, Fade: fade, Target: target, ctx: ctx, cancel: cancel}
+	ts.next++
+	ts.timers[t.ID] = t
+
+	goesOff := at
+	if kind == SleepTimer {
+		goesOff = at.Add(-fade)
+	}
+	t.timer = time.AfterFunc(goesOff.Sub(ts.now()), func() {
+		ts.mu.Lock()
+		live := ts.timers[t.ID] == t
+		if live {
+			t.fired = true
+		}
+		ts.mu.Unlock()
+		if !live {
+			return
+		}
+		select {
+		case ts.due <- t:
+		case <-ctx.Done():
+		}
+	})
+	return t
+}
+
+// Cancel removes a timer and stops whatever it's doing
+func (ts *Timers) Cancel(id int) (*Timer, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	t, ok := ts.timers[id]
+	if ok {
+		ts.remove(t)
+	}
+	return t, ok
+}
+
+// CancelKind removes every timer of a kind, returning how many there were
+func (ts *Timers) CancelKind(kind TimerKind) int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	n := 0
+	for _, t := range ts.timers {
+		if t.Kind == kind {
+			ts.remove(t)
+			n++
+		}
+	}
+	return n
+}
+
+// Finish takes a timer off the list once it's done its job
+func (ts *Timers) Finish(t *Timer) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.timers[t.ID] == t {
+		delete(ts.timers, t.ID)
+	}
+}
+
+func (ts *Timers) remove(t *Timer) {
+	t.timer.Stop()
+	t.cancel()
+	delete(ts.timers, t.ID)
+}
+
+// List returns the timers, soonest first
+func (ts *Timers) List() []Timer {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	list := make([]Timer, 0, len(ts.timers))
+	for _, t := range ts.timers {
+		list = append(list, *t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].At.Before(list[j].At) })
+	return list
+}
+
+// Due delivers timers as they go off
+func (ts *Timers) Due() <-chan *Timer {
+	return ts.due
+}
+
+// ParseClock reads an alarm time like 7:30, 07:30, 19:30, 7am or 7:30pm and returns the
+// next time the clock shows it
+func ParseClock(s string, now time.Time) (time.Time, error) {
+	clock := strings.ToLower(strings.TrimSpace(s))
+	offset := 0
+	switch {
+	case strings.HasSuffix(clock, "am"):
+		clock = strings.TrimSuffix(clock, "am")
+	case strings.HasSuffix(clock, "pm"):
+		clock, offset = strings.TrimSuffix(clock, "pm"), 12
+	default:
+		offset = -1
+	}
+
+	hours, minutes, found := strings.Cut(strings.TrimSpace(clock), ":")
+	h, err := strconv.Atoi(hours)
+	m := 0
+	if err == nil && found {
+		m, err = strconv.Atoi(minutes)
+	}
+	bad := err != nil || m < 0 || m > 59 || (found && len(minutes) != 2)
+	if offset < 0 {
+		bad = bad || h < 0 || h > 23 || !found
+	} else {
+		bad = bad || h < 1 || h > 12
+		h = h%12 + offset
+	}
+	if bad {
+		return time.Time{}, fmt.Errorf("can't read %q as a time, try 7:30, 19:30 or 7:30am", s)
+	}
+
+	at := time.Date(now.Year(), now.Month(), now.Day(), h, m, 0, 0, now.Location())
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at, nil
+}
@@ -0,0 +1,102 @@
+package playback
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	now := time.Date(2024, 3, 9, 22, 15, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want string // "" for an error
+	}{
+		{"7:30", "2024-03-10 07:30"},
+		{"07:05", "2024-03-10 07:05"},
+		{"23:00", "2024-03-09 23:00"},
+		{"22:15", "2024-03-10 22:15"}, // now is already too late
+		{"7am", "2024-03-10 07:00"},
+		{"7:30PM", "2024-03-10 19:30"},
+		{"11:45pm", "2024-03-09 23:45"},
+		{"12am", "2024-03-10 00:00"},
+		{"12:30pm", "2024-03-10 12:30"},
+		{"7", ""},
+		{"24:00", ""},
+		{"7:5", ""},
+		{"13pm", ""},
+		{"soon", ""},
+	}
+	for _, tt := range tests {
+		got, err := ParseClock(tt.in, now)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseClock(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got.Format("2006-01-02 15:04") != tt.want {
+			t.Errorf("ParseClock(%q) = %v, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestTimers(t *testing.T) {
+	timers := NewTimers()
+	now := time.Now()
+	alarm := timers.Add(AlarmTimer, now.Add(time.Hour), time.Minute, "jazz")
+	timers.Add(SleepTimer, now.Add(2*time.Hour), time.Minute, "")
+	// a new sleep timer replaces the old one, and goes off a fade before it's done
+	sleep := timers.Add(SleepTimer, now.Add(time.Minute+20*time.Millisecond), time.Minute, "")
+
+	list := timers.List()
+	if len(list) != 2 || list[0].ID != sleep.ID || list[1].ID != alarm.ID {
+		t.Fatalf("List = %+v, want the new sleep timer then the alarm", list)
+	}
+
+	select {
+	case due := <-timers.Due():
+		if due != sleep || !due.Fired() {
+			t.Errorf("due = %+v, want the sleep timer", due)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the sleep timer never went off")
+	}
+	if len(timers.List()) != 2 {
+		t.Error("a timer that went off should stay listed until it's finished")
+	}
+	timers.Finish(sleep)
+
+	if _, ok := timers.Cancel(alarm.ID); !ok {
+		t.Error("Cancel didn't find the alarm")
+	}
+	if alarm.Context().Err() == nil {
+		t.Error("cancelling should cancel the timer's context")
+	}
+	if len(timers.List()) != 0 {
+		t.Errorf("timers left: %+v", timers.List())
+	}
+}
+
+func TestPlayerFade(t *testing.T) {
+	fake := NewFake()
+	p := NewPlayer(fake)
+	defer p.Close()
+
+	if err := p.Fade(context.Background(), 80, 20, 3*fadeStep); err != nil {
+		t.Fatalf("Fade failed: %v", err)
+	}
+	if fake.Volume != 20 || len(fake.Calls) != 4 {
+		t.Errorf("volume = %d after %v, want 20 in 4 steps", fake.Volume, fake.Calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(fadeStep/2, cancel)
+	if err := p.Fade(ctx, 20, 100, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Fade = %v", err)
+	}
+	if v := p.State().Volume; v != 20 && v != 21 {
+		t.Errorf("volume = %d, want the fade to stop near the start", v)
+	}
+}
@@ -0,0 +1,347 @@
+package playback
+
+import (
+	"cli-radio/api"
+	"cli-radio/icy"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeShiftOptions keeps the last few minutes of the station around so you can go back
+type TimeShiftOptions struct {
+	// Minutes of audio to keep, 0 turns time-shift off
+	Minutes float64 `json:"minutes"`
+}
+
+const (
+	// assumed for streams that don't say, only used to size the buffer and turn seconds into bytes
+	fallbackBitrate = 128
+	// VBR streams run over their nominal bitrate, so the buffer gets some room to spare
+	bufferHeadroom = 1.25
+	// `live` starts this far back so the player has something to fill its cache with
+	liveLead = 2 * time.Second
+	// how far ahead of real time the backend may read, it would take the whole buffer into
+	// its cache otherwise and we'd lose track of what it's actually playing
+	defaultBurst = 3 * time.Second
+)
+
+var ErrNoTimeShift = errors.New("time-shift is off, set player.timeshift.minutes to use it")
+
+// timeShift reads the station itself into a ring buffer and has the backend play it back
+// from a local HTTP server, so it can start the backend again at any point in the buffer.
+// Titles come from the buffer too, as playback reaches them.
+type timeShift struct {
+	Backend
+	minutes float64
+	burst   time.Duration
+	client  *http.Client
+	events  chan Event
+
+	serve    sync.Once
+	addr     string
+	serveErr error
+
+	playMu sync.Mutex // Play, Stop and seeks take turns on the backend
+
+	mu          sync.Mutex
+	ring        *ring // nil when we're not shifting this station
+	station     *api.Station
+	contentType string
+	cancel      context.CancelFunc
+	generation  int   // bumped on every restart so an old request stops moving the playhead
+	playhead    int64 // how far the backend has read
+	paused      bool
+	title       string // the last title sent
+	charset     icy.Hint
+	tap         func([]byte) // gets what the backend reads, for the dead air watch
+}
+
+func withTimeShift(p Backend, opts TimeShiftOptions) *timeShift {
+	t := &timeShift{Backend: p, minutes: opts.Minutes, burst: defaultBurst, client: icy.NewClient(), events: make(chan Event, eventBuffer)}
+	go func() {
+		for e := range p.Events() {
+			// the local stream has no titles, ours come from the buffer
+			if e.Kind != SongChanged {
+				forward(t.events, e)
+			}
+		}
+	}()
+	return t
+}
+
+func (t *timeShift) Play(station *api.Station) error {
+	t.playMu.Lock()
+	defer t.playMu.Unlock()
+	t.stopFetching()
+
+	if station.HLS {
+		// a playlist of segments rather than one stream, nothing we can buffer
+		return t.Backend.Play(station)
+	}
+	if t.serve.Do(t.listen); t.serveErr != nil {
+		return fmt.Errorf("failed to start time-shift server: %w", t.serveErr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var buffer *ring
+	stream, err := icy.Open(ctx, t.client, station.StreamURL(), func(m icy.Metadata) {
+		buffer.mark(strings.TrimSpace(m.StreamTitle))
+	})
+	if err != nil {
+		cancel()
+		return err
+	}
+	kbps := stream.Headers.Bitrate
+	if kbps <= 0 {
+		kbps = station.Bitrate
+	}
+	if kbps <= 0 {
+		kbps = fallbackBitrate
+	}
+	rate := kbps * 1000 / 8
+	buffer = newRing(int(t.minutes*60*float64(rate)*bufferHeadroom), rate)
+	go func() {
+		defer stream.Close()
+		_, err := io.Copy(buffer, stream.Body)
+		buffer.close(err)
+	}()
+
+	t.mu.Lock()
+	t.ring, t.station, t.cancel = buffer, station, cancel
+	t.contentType = stream.Headers.ContentType
+	t.charset = charsetHint(station)
+	t.title, t.paused = "", false
+	t.mu.Unlock()
+	if err := t.start(0); err != nil {
+		t.stopFetching()
+		return err
+	}
+	return nil
+}
+
+func (t *timeShift) Stop() error {
+	t.playMu.Lock()
+	defer t.playMu.Unlock()
+	t.stopFetching()
+	return t.Backend.Stop()
+}
+
+// Pause stops the backend but keeps buffering, resuming picks up where it left off
+func (t *timeShift) Pause(paused bool) error {
+	t.playMu.Lock()
+	defer t.playMu.Unlock()
+	t.mu.Lock()
+	shifting, wasPaused, playhead := t.ring != nil, t.paused, t.playhead
+	t.mu.Unlock()
+	if !shifting {
+		return t.Backend.Pause(paused)
+	}
+	if paused == wasPaused {
+		return nil
+	}
+	if !paused {
+		return t.start(playhead)
+	}
+	t.mu.Lock()
+	t.paused = true
+	t.generation++
+	t.mu.Unlock()
+	return t.Backend.Stop()
+}
+
+// Rewind goes back from what's playing now, as far as the buffer reaches
+func (t *timeShift) Rewind(d time.Duration) error {
+	t.playMu.Lock()
+	defer t.playMu.Unlock()
+	t.mu.Lock()
+	buffer, playhead := t.ring, t.playhead
+	t.mu.Unlock()
+	if buffer == nil {
+		return errors.New("nothing to rewind")
+	}
+	return t.start(playhead - int64(d.Seconds()*float64(buffer.rate)))
+}
+
+// Live jumps back to the live edge
+func (t *timeShift) Live() error {
+	t.playMu.Lock()
+	defer t.playMu.Unlock()
+	t.mu.Lock()
+	buffer := t.ring
+	t.mu.Unlock()
+	if buffer == nil {
+		return errors.New("nothing playing")
+	}
+	_, end := buffer.edges()
+	return t.start(end - int64(liveLead.Seconds()*float64(buffer.rate)))
+}
+
+// Behind is how far playback is from the live edge, and how far back the buffer goes
+func (t *timeShift) Behind() (behind, reach time.Duration) {
+	t.mu.Lock()
+	buffer, playhead := t.ring, t.playhead
+	t.mu.Unlock()
+	if buffer == nil {
+		return 0, 0
+	}
+	start, end := buffer.edges()
+	seconds := func(bytes int64) time.Duration {
+		return time.Duration(bytes) * time.Second / time.Duration(buffer.rate)
+	}
+	return seconds(end - playhead), seconds(end - start)
+}
+
+// Clip returns the last d of audio up to what's playing now, as the station sent it
+func (t *timeShift) Clip(d time.Duration) ([]byte, error) {
+	t.mu.Lock()
+	buffer, playhead := t.ring, t.playhead
+	t.mu.Unlock()
+	if buffer == nil {
+		return nil, errors.New("nothing buffered")
+	}
+	clip := buffer.slice(playhead-int64(d.Seconds()*float64(buffer.rate)), playhead)
+	if len(clip) == 0 {
+		return nil, errors.New("nothing buffered yet")
+	}
+	return clip, nil
+}
+
+func (t *timeShift) Events() <-chan Event {
+	return t.events
+}
+
+// setTap hands every chunk the backend reads to tap as well. tap mustn't block or keep the chunk.
+func (t *timeShift) setTap(tap func([]byte)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tap = tap
+}
+
+// start has the backend play the buffer from pos, the caller holds playMu
+func (t *timeShift) start(pos int64) error {
+	t.mu.Lock()
+	start, end := t.ring.edges()
+	pos = max(start, min(pos, end))
+	t.generation++
+	t.playhead, t.paused = pos, false
+	local := *t.station
+	local.URL = fmt.Sprintf("http://%s/%d/%d", t.addr, t.generation, pos)
+	local.URLResolved = ""
+	t.mu.Unlock()
+	return t.Backend.Play(&local)
+}
+
+func (t *timeShift) stopFetching() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancel != nil {
+		t.cancel()
+		t.cancel = nil
+	}
+	if t.ring != nil {
+		t.ring.close(context.Canceled)
+		t.ring = nil
+	}
+	t.generation++
+}
+
+func (t *timeShift) listen() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.serveErr = err
+		return
+	}
+	t.addr = listener.Addr().String()
+	go http.Serve(listener, t)
+}
+
+// ServeHTTP streams the buffer to the backend from the position in the URL, /<generation>/<position>
+func (t *timeShift) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	generation, err1 := strconv.Atoi(parts[0])
+	pos, err2 := strconv.ParseInt(parts[1], 10, 64)
+	t.mu.Lock()
+	buffer, contentType, charset := t.ring, t.contentType, t.charset
+	current := generation == t.generation
+	t.mu.Unlock()
+	if err1 != nil || err2 != nil || !current || buffer == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	chunk := make([]byte, 16<<10)
+	started, sent := time.Now(), int64(0)
+	for {
+		if title, ok := buffer.titleAt(pos); ok {
+			t.titleReached(generation, title, charset)
+		}
+		allowed := int64((t.burst+time.Since(started)).Seconds()*float64(buffer.rate)) - sent
+		if allowed <= 0 {
+			select {
+			case <-time.After(100 * time.Millisecond):
+				continue
+			case <-r.Context().Done():
+				return
+			}
+		}
+		limit := min(int64(len(chunk)), allowed)
+		if next, ok := buffer.nextTitle(pos); ok {
+			// stop at the next title so it's announced when playback gets there
+			limit = min(limit, next-pos)
+		}
+		n, from, err := buffer.readAt(r.Context(), pos, chunk[:limit])
+		if err != nil {
+			return
+		}
+		sent += int64(n)
+		if _, err := w.Write(chunk[:n]); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		pos = from + int64(n)
+
+		t.mu.Lock()
+		if generation != t.generation {
+			t.mu.Unlock()
+			return
+		}
+		t.playhead = pos
+		tap := t.tap
+		t.mu.Unlock()
+		if tap != nil {
+			tap(chunk[:n])
+		}
+	}
+}
+
+// titleReached sends SongChanged when playback gets to a new title
+func (t *timeShift) titleReached(generation int, title string, charset icy.Hint) {
+	t.mu.Lock()
+	changed := generation == t.generation && title != t.title
+	if changed {
+		t.title = title
+	}
+	t.mu.Unlock()
+	if changed {
+		sendEvent(t.events, Event{Kind: SongChanged, Title: title}, charset)
+	}
+}
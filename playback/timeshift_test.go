@@ -0,0 +1,175 @@
+package playback
+
+import (
+	"bytes"
+	"cli-radio/api"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// liveServer sends a chunk of audio and a title for every string on titles, and holds the
+// connection open in between like a live stream. At 8 kbps a chunk is one second.
+func liveServer(titles chan string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("icy-br", "8")
+		w.Header().Set("icy-metaint", fmt.Sprint(testMetaint))
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for i := 0; ; i++ {
+			select {
+			case title := <-titles:
+				w.Write(bytes.Repeat([]byte{byte('a' + i)}, testMetaint))
+				w.Write(metadata(title))
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+}
+
+// listen plays the part of the backend, reading n bytes from whatever it was last told to play
+func listen(t *testing.T, fake *Fake, n int) []byte {
+	t.Helper()
+	fake.mu.Lock()
+	url := fake.URL
+	fake.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("backend couldn't open %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	audio := make([]byte, n)
+	if _, err := io.ReadFull(resp.Body, audio); err != nil {
+		t.Fatalf("reading %s: %v", url, err)
+	}
+	return audio
+}
+
+func TestTimeShift(t *testing.T) {
+	titles := make(chan string)
+	server := liveServer(titles)
+	defer server.Close()
+
+	fake := NewFake()
+	shift := withTimeShift(fake, TimeShiftOptions{Minutes: 0.1})
+	shift.burst = time.Hour
+	if err := shift.Play(&api.Station{Name: "Shifty FM", URL: server.URL}); err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	defer shift.Stop()
+	// a title arrives after its first chunk, so chunk 0 has no title
+	for _, title := range []string{"Sade - Cherish the Day", "Sade - Cherish the Day", "Kelis - Milkshake"} {
+		titles <- title
+	}
+	waitFor(t, "the buffer", func() bool { _, end := shift.ring.edges(); return end == 3000 })
+
+	audio := listen(t, fake, 3000)
+	if !bytes.Equal(audio[:1000], bytes.Repeat([]byte{'a'}, 1000)) || audio[2999] != 'c' {
+		t.Errorf("backend got %q...%q", audio[:1], audio[2999:])
+	}
+	for _, want := range []string{"Cherish the Day", "Milkshake"} {
+		if e := nextEvent(t, shift); e.Kind != SongChanged || e.Song.Title != want {
+			t.Fatalf("got %+v, want %s", e, want)
+		}
+	}
+
+	// 1.5 seconds back lands halfway through chunk 1, which is back on the first song
+	if err := shift.Rewind(1500 * time.Millisecond); err != nil {
+		t.Fatalf("Rewind failed: %v", err)
+	}
+	if audio := listen(t, fake, 1500); audio[0] != 'b' || audio[1499] != 'c' {
+		t.Errorf("after rewinding backend got %q...%q", audio[:1], audio[1499:])
+	}
+	if e := nextEvent(t, shift); e.Song.Title != "Cherish the Day" {
+		t.Errorf("after rewinding got %+v", e)
+	}
+	if clip, err := shift.Clip(time.Second); err != nil || !bytes.Equal(clip, bytes.Repeat([]byte{'c'}, 1000)) {
+		t.Errorf("Clip = %d bytes, %v", len(clip), err)
+	}
+
+	// the stream keeps coming in while paused
+	if err := shift.Pause(true); err != nil || fake.Playing {
+		t.Fatalf("Pause = %v, backend still playing: %v", err, fake.Playing)
+	}
+	titles <- "Kelis - Milkshake"
+	titles <- "Kelis - Milkshake"
+	waitFor(t, "the buffer", func() bool { _, end := shift.ring.edges(); return end == 5000 })
+	if behind, reach := shift.Behind(); behind != 2*time.Second || reach != 5*time.Second {
+		t.Errorf("Behind = %v, %v, want 2s and 5s", behind, reach)
+	}
+	if err := shift.Pause(false); err != nil {
+		t.Fatalf("resuming failed: %v", err)
+	}
+	if audio := listen(t, fake, 2000); audio[0] != 'd' || audio[1999] != 'e' {
+		t.Errorf("after resuming backend got %q...%q", audio[:1], audio[1999:])
+	}
+
+	if err := shift.Live(); err != nil {
+		t.Fatalf("Live failed: %v", err)
+	}
+	if behind, _ := shift.Behind(); behind != liveLead {
+		t.Errorf("Live left us %v behind, want %v", behind, liveLead)
+	}
+}
+
+func TestTimeShiftStalledStation(t *testing.T) {
+	p := NewPlayer(withTimeShift(NewFake(), TimeShiftOptions{Minutes: 0.1}))
+	impatient(p.backend.(*timeShift).client)
+	done := make(chan error, 1)
+	go func() { done <- p.Play(&api.Station{Name: "Silent Treatment FM", URL: stalledServer(t)}) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Play succeeded without any headers")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Play is still waiting on the station")
+	}
+	// and the player still takes commands
+	closed := make(chan struct{})
+	go func() { p.Close(); close(closed) }()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close is stuck behind the stalled station")
+	}
+}
+
+func TestRingDropsOldest(t *testing.T) {
+	r := newRing(10, 1)
+	r.mark("one")
+	r.Write([]byte("0123456"))
+	r.mark("two")
+	r.Write([]byte("789abcdef"))
+
+	if start, end := r.edges(); start != 6 || end != 16 {
+		t.Errorf("edges = %d, %d, want 6, 16", start, end)
+	}
+	p := make([]byte, 20)
+	n, from, _ := r.readAt(context.Background(), 0, p)
+	if from != 6 || string(p[:n]) != "6789" {
+		// a read stops where the ring wraps
+		t.Errorf("readAt(0) = %q from %d", p[:n], from)
+	}
+	if got := string(r.slice(0, 100)); got != "6789abcdef" {
+		t.Errorf("slice = %q", got)
+	}
+	if title, _ := r.titleAt(6); title != "one" {
+		t.Errorf("title at the oldest byte = %q, want one", title)
+	}
+
+	r.close(nil)
+	if _, _, err := r.readAt(context.Background(), 16, p); err != io.EOF {
+		t.Errorf("reading past the end of a closed ring = %v", err)
+	}
+}
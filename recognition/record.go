@@ -1,6 +1,7 @@
 package recognition
 
 import (
+	"bytes"
 	"fmt"
 	"os/exec"
 )
@@ -32,3 +33,24 @@ func RecordClip() error {
 	fmt.Println("Recording complete.")
 	return nil
 }
+
+// ClipFrom decodes audio straight from the stream into the clip, instead of recording what
+// comes out of the speakers
+func ClipFrom(audio []byte) error {
+	cmd := exec.Command(
+		"ffmpeg",
+		"-y",
+		"-i", "pipe:0",
+		"-t", "7",
+		"-ch_layout", "mono",
+		"-ar", "44100",
+		"-acodec", "pcm_s16le",
+		"-f", "s16le",
+		OutputFile,
+	)
+	cmd.Stdin = bytes.NewReader(audio)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("decoding clip failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"cli-radio/api"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var blocklistFile = "store/blocklist.json"
+
+// Ban is a station we never want to hear again. The url is kept too since some stations
+// get re-submitted to radio-browser under a new uuid.
+type Ban struct {
+	UUID     string    `json:"uuid"`
+	URL      string    `json:"url"`
+	Name     string    `json:"name"`
+	BannedAt time.Time `json:"banned_at"`
+}
+
+type Blocklist struct {
+	path string
+	mu   sync.Mutex
+	bans []Ban
+}
+
+// OpenBlocklist loads store/blocklist.json
+func OpenBlocklist() (*Blocklist, error) {
+	return LoadBlocklist(blocklistFile)
+}
+
+func LoadBlocklist(path string) (*Blocklist, error) {
+	b := &Blocklist{path: path}
+	if err := readJSON(path, &b.bans); err != nil {
+		return nil, fmt.Errorf("failed to load blocklist: %w", err)
+	}
+	return b, nil
+}
+
+// Ban records a station, returning false if it was already banned
+func (b *Blocklist) Ban(s *api.Station) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.indexOf(s) >= 0 {
+		return false, nil
+	}
+	b.bans = append(b.bans, Ban{UUID: s.UUID, URL: s.StreamURL(), Name: s.Name, BannedAt: time.Now()})
+	return true, writeJSON(b.path, b.bans)
+}
+
+// Unban removes the nth (1-based) ban
+func (b *Blocklist) Unban(n int) (*Ban, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n < 1 || n > len(b.bans) {
+		return nil, fmt.Errorf("no ban %d", n)
+	}
+	removed := b.bans[n-1]
+	b.bans = append(b.bans[:n-1], b.bans[n:]...)
+	return &removed, writeJSON(b.path, b.bans)
+}
+
+// IsBanned reports whether the station matches a ban by uuid or stream url
+func (b *Blocklist) IsBanned(s *api.Station) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.indexOf(s) >= 0
+}
+
+// List returns a copy of every ban, oldest first
+func (b *Blocklist) List() []Ban {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Ban(nil), b.bans...)
+}
+
+func (b *Blocklist) indexOf(s *api.Station) int {
+	for i, ban := range b.bans {
+		if ban.UUID != "" && ban.UUID == s.UUID {
+			return i
+		}
+		if ban.URL != "" && (ban.URL == s.URL || ban.URL == s.URLResolved) {
+			return i
+		}
+	}
+	return -1
+}
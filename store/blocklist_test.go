@@ -0,0 +1,38 @@
+package store
+
+import (
+	"cli-radio/api"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	bans, err := LoadBlocklist(path)
+	if err != nil {
+		t.Fatalf("LoadBlocklist failed: %v", err)
+	}
+
+	awful := &api.Station{UUID: "awful", Name: "All Ads FM", URL: "http://ads.example/stream"}
+	if banned, err := bans.Ban(awful); !banned || err != nil {
+		t.Fatalf("Ban = %v, %v", banned, err)
+	}
+
+	reloaded, _ := LoadBlocklist(path)
+	// re-submitted under a new uuid, but still the same stream
+	resubmitted := &api.Station{UUID: "new-uuid", URL: "http://other.example/x", URLResolved: "http://ads.example/stream"}
+	if !reloaded.IsBanned(awful) || !reloaded.IsBanned(resubmitted) {
+		t.Error("banned station not recognised after reload")
+	}
+	if reloaded.IsBanned(&api.Station{UUID: "fine", URL: "http://fine.example/stream"}) {
+		t.Error("unrelated station reported as banned")
+	}
+
+	removed, err := reloaded.Unban(1)
+	if err != nil || removed.Name != "All Ads FM" {
+		t.Fatalf("Unban(1) = %v, %v", removed, err)
+	}
+	if again, _ := LoadBlocklist(path); again.IsBanned(awful) {
+		t.Error("station still banned after Unban")
+	}
+}
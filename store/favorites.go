@@ -0,0 +1,110 @@
+package store
+
+import (
+	"cli-radio/api"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+var favoritesFile = "store/favorites.json"
+
+// Favorites is the list of saved stations, kept in the order they were added
+type Favorites struct {
+	path     string
+	mu       sync.Mutex
+	stations []api.Station
+}
+
+// OpenFavorites loads store/favorites.json
+func OpenFavorites() (*Favorites, error) {
+	return LoadFavorites(favoritesFile)
+}
+
+func LoadFavorites(path string) (*Favorites, error) {
+	f := &Favorites{path: path}
+	if err := readJSON(path, &f.stations); err != nil {
+		return nil, fmt.Errorf("failed to load favorites: %w", err)
+	}
+	return f, nil
+}
+
+// Add saves a station, returning false if it was already a favorite
+func (f *Favorites) Add(s *api.Station) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.indexOf(s.Key()) >= 0 {
+		return false, nil
+	}
+	f.stations = append(f.stations, *s)
+	return true, writeJSON(f.path, f.stations)
+}
+
+// Remove drops a station, returning false if it wasn't a favorite
+func (f *Favorites) Remove(s *api.Station) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.indexOf(s.Key())
+	if i < 0 {
+		return false, nil
+	}
+	f.stations = append(f.stations[:i], f.stations[i+1:]...)
+	return true, writeJSON(f.path, f.stations)
+}
+
+// Contains reports whether the station is a favorite
+func (f *Favorites) Contains(s *api.Station) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.indexOf(s.Key()) >= 0
+}
+
+// Get returns the nth (1-based) favorite
+func (f *Favorites) Get(n int) (*api.Station, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n < 1 || n > len(f.stations) {
+		return nil, fmt.Errorf("no favorite %d", n)
+	}
+	s := f.stations[n-1]
+	return &s, nil
+}
+
+// List returns a copy of every favorite
+func (f *Favorites) List() []api.Station {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]api.Station(nil), f.stations...)
+}
+
+func (f *Favorites) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.stations)
+}
+
+func (f *Favorites) indexOf(key string) int {
+	for i := range f.stations {
+		if f.stations[i].Key() == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Random picks a favorite other than the one given, for shuffle mode
+func (f *Favorites) Random(not *api.Station) (*api.Station, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var choices []api.Station
+	for _, s := range f.stations {
+		if not == nil || s.Key() != not.Key() {
+			choices = append(choices, s)
+		}
+	}
+	if len(choices) == 0 {
+		return nil, false
+	}
+	s := choices[rand.Intn(len(choices))]
+	return &s, true
+}
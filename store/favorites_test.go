@@ -0,0 +1,44 @@
+package store
+
+import (
+	"cli-radio/api"
+	"path/filepath"
+	"testing"
+)
+
+func TestFavoritesPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "favorites.json")
+	favs, err := LoadFavorites(path)
+	if err != nil {
+		t.Fatalf("LoadFavorites failed: %v", err)
+	}
+
+	a := &api.Station{UUID: "a", Name: "A", Tags: []string{"jazz"}}
+	b := &api.Station{UUID: "b", Name: "B"}
+	if added, err := favs.Add(a); !added || err != nil {
+		t.Fatalf("Add(a) = %v, %v", added, err)
+	}
+	if added, _ := favs.Add(&api.Station{UUID: "a", Name: "A renamed"}); added {
+		t.Error("adding the same uuid twice should be a no-op")
+	}
+	favs.Add(b)
+
+	reloaded, err := LoadFavorites(path)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if reloaded.Len() != 2 || !reloaded.Contains(b) {
+		t.Fatalf("reloaded favorites = %+v", reloaded.List())
+	}
+	if got, _ := reloaded.Get(1); got.Name != "A" || got.Tags[0] != "jazz" {
+		t.Errorf("Get(1) = %+v", got)
+	}
+
+	if removed, err := reloaded.Remove(a); !removed || err != nil {
+		t.Fatalf("Remove(a) = %v, %v", removed, err)
+	}
+	again, _ := LoadFavorites(path)
+	if again.Len() != 1 || again.Contains(a) {
+		t.Errorf("after Remove favorites = %+v", again.List())
+	}
+}
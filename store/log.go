@@ -0,0 +1,333 @@
+package store
+
+import (
+	"bufio"
+	"cli-radio/api"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logFile = "store/history.jsonl"
+
+// record kinds, one JSON object per line in the log
+const (
+	kindStation  = "station"
+	kindSong     = "song"
+	kindDetected = "detected"
+	kindAdded    = "added"
+	kindStop     = "stop"
+	kindFailed   = "failed"
+)
+
+type record struct {
+	Time        time.Time `json:"time"`
+	Kind        string    `json:"kind"`
+	StationUUID string    `json:"station_uuid,omitempty"`
+	StationName string    `json:"station_name,omitempty"`
+	Country     string    `json:"country,omitempty"`
+	CountryCode string    `json:"countrycode,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Song is a title seen while listening, and what we did with it
+type Song struct {
+	Title    string
+	At       time.Time
+	Detected bool // identified with Shazam
+	Added    bool // added to the Spotify playlist
+}
+
+// Listen is one stretch of time spent on a station
+type Listen struct {
+	StationUUID string
+	StationName string
+	Country     string
+	CountryCode string
+	Start       time.Time
+	End         time.Time // zero if the session ended without a stop being written
+	Songs       []Song
+	Failed      string // why the stream gave out, if it did
+}
+
+// Log is the append-only listening history. Nothing is ever rewritten, so a crash
+// loses at most the line being written.
+type Log struct {
+	path string
+	mu   sync.Mutex
+	now  func() time.Time
+}
+
+// OpenLog uses store/history.jsonl
+func OpenLog() *Log {
+	return NewLog(logFile)
+}
+
+func NewLog(path string) *Log {
+	return &Log{path: path, now: time.Now}
+}
+
+// StationStarted marks the start of a listen, ending whatever came before
+func (l *Log) StationStarted(s *api.Station) error {
+	return l.append(record{Kind: kindStation, StationUUID: s.UUID, StationName: s.Name, Country: s.Country, CountryCode: s.CountryCode})
+}
+
+// SongSeen records a title from the stream
+func (l *Log) SongSeen(title string) error {
+	return l.append(record{Kind: kindSong, Title: title})
+}
+
+// SongDetected records a song identified with Shazam
+func (l *Log) SongDetected(title string) error {
+	return l.append(record{Kind: kindDetected, Title: title})
+}
+
+// SongAdded records a song added to the playlist
+func (l *Log) SongAdded(title string) error {
+	return l.append(record{Kind: kindAdded, Title: title})
+}
+
+// Stopped ends the current listen
+func (l *Log) Stopped() error {
+	return l.append(record{Kind: kindStop})
+}
+
+// StationFailed ends the current listen because the stream kept dropping
+func (l *Log) StationFailed(s *api.Station, cause error) error {
+	return l.append(record{Kind: kindFailed, StationUUID: s.UUID, StationName: s.Name, Error: cause.Error()})
+}
+
+func (l *Log) append(r record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r.Time = l.now()
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history log: %w", err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Listens replays the log and returns the listens matching q, most recent first
+func (l *Log) Listens(q Query) ([]Listen, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history log: %w", err)
+	}
+	defer f.Close()
+
+	var listens []Listen
+	var current *Listen
+	end := func(at time.Time) {
+		if current != nil {
+			current.End = at
+			listens = append(listens, *current)
+			current = nil
+		}
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// a torn last line from a crash shouldn't hide everything else
+			continue
+		}
+		switch r.Kind {
+		case kindStation:
+			end(r.Time)
+			current = &Listen{StationUUID: r.StationUUID, StationName: r.StationName, Country: r.Country, CountryCode: r.CountryCode, Start: r.Time}
+		case kindStop:
+			end(r.Time)
+		case kindFailed:
+			if current != nil {
+				current.Failed = r.Error
+			}
+			end(r.Time)
+		case kindSong, kindDetected, kindAdded:
+			if current != nil {
+				current.markSong(r)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history log: %w", err)
+	}
+	if current != nil {
+		listens = append(listens, *current)
+	}
+
+	var matched []Listen
+	for i := len(listens) - 1; i >= 0; i-- {
+		if listen, ok := q.apply(listens[i]); ok {
+			matched = append(matched, listen)
+			if q.Limit > 0 && len(matched) == q.Limit {
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+func (listen *Listen) markSong(r record) {
+	var song *Song
+	// detection/adding refers to the latest song with that title, if we saw one
+	for i := len(listen.Songs) - 1; i >= 0; i-- {
+		if listen.Songs[i].Title == r.Title {
+			song = &listen.Songs[i]
+			break
+		}
+	}
+	if song == nil || (r.Kind == kindSong && song != &listen.Songs[len(listen.Songs)-1]) {
+		listen.Songs = append(listen.Songs, Song{Title: r.Title, At: r.Time})
+		song = &listen.Songs[len(listen.Songs)-1]
+	}
+	switch r.Kind {
+	case kindDetected:
+		song.Detected = true
+	case kindAdded:
+		song.Added = true
+	}
+}
+
+// Query narrows down the listening log
+type Query struct {
+	Station string    // part of the station name
+	Country string    // country code or part of the country name
+	Title   string    // part of a song title; only matching songs are kept
+	From    time.Time // listens overlapping [From, To)
+	To      time.Time
+	Limit   int
+}
+
+// ParseQuery reads `log` arguments such as `country=BR day=tuesday song=love`.
+// Days can be a date (2006-01-02), today, yesterday or a weekday meaning the most recent one.
+func ParseQuery(args []string, now time.Time) (Query, error) {
+	q := Query{Limit: 10}
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if !found {
+			return q, fmt.Errorf("filters look like key=value, got %q", arg)
+		}
+		switch strings.ToLower(key) {
+		case "station":
+			q.Station = value
+		case "country":
+			q.Country = value
+		case "song", "title":
+			q.Title = value
+		case "day", "date":
+			day, err := parseDay(value, now)
+			if err != nil {
+				return q, err
+			}
+			q.From, q.To = day, day.AddDate(0, 0, 1)
+		case "days":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return q, fmt.Errorf("days must be a positive number: %q", value)
+			}
+			q.From, q.To = startOfDay(now).AddDate(0, 0, 1-n), time.Time{}
+		case "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("limit must be a number: %q", value)
+			}
+			q.Limit = n
+		default:
+			return q, fmt.Errorf("unknown log filter %q", key)
+		}
+	}
+	return q, nil
+}
+
+func parseDay(value string, now time.Time) (time.Time, error) {
+	today := startOfDay(now)
+	switch v := strings.ToLower(value); v {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	default:
+		for d := 1; d <= 7; d++ {
+			day := today.AddDate(0, 0, -d)
+			if strings.HasPrefix(strings.ToLower(day.Weekday().String()), v) && len(v) >= 3 {
+				return day, nil
+			}
+		}
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown day %q, use a date, today, yesterday or a weekday", value)
+	}
+	return day, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// apply checks a listen against the query, trimming its songs down to the matching ones
+func (q Query) apply(listen Listen) (Listen, bool) {
+	if q.Station != "" && !containsFold(listen.StationName, q.Station) {
+		return listen, false
+	}
+	if q.Country != "" && !strings.EqualFold(listen.CountryCode, q.Country) && !containsFold(listen.Country, q.Country) {
+		return listen, false
+	}
+	end := listen.End
+	if end.IsZero() {
+		end = listen.Start
+		for _, s := range listen.Songs {
+			if s.At.After(end) {
+				end = s.At
+			}
+		}
+	}
+	if !q.From.IsZero() && end.Before(q.From) {
+		return listen, false
+	}
+	if !q.To.IsZero() && !listen.Start.Before(q.To) {
+		return listen, false
+	}
+	if q.Title != "" {
+		var songs []Song
+		for _, s := range listen.Songs {
+			if containsFold(s.Title, q.Title) {
+				songs = append(songs, s)
+			}
+		}
+		if len(songs) == 0 {
+			return listen, false
+		}
+		listen.Songs = songs
+	}
+	return listen, true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
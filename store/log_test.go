@@ -0,0 +1,91 @@
+package store
+
+import (
+	"cli-radio/api"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogListens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	log := NewLog(path)
+
+	// Wednesday 2024-01-10, so "tuesday" is the day before
+	now := time.Date(2024, 1, 10, 20, 0, 0, 0, time.UTC)
+	clock := now.AddDate(0, 0, -1)
+	log.now = func() time.Time { clock = clock.Add(time.Minute); return clock }
+
+	brazil := &api.Station{UUID: "br", Name: "Rádio Samba", Country: "Brazil", CountryCode: "BR"}
+	japan := &api.Station{UUID: "jp", Name: "Jazz Tokyo", Country: "Japan", CountryCode: "JP"}
+
+	log.StationStarted(brazil)
+	log.SongSeen("Jorge Ben - Mas Que Nada")
+	log.SongSeen("Jorge Ben - Mas Que Nada")
+	log.SongDetected("Jorge Ben - Mas Que Nada")
+	log.SongAdded("Jorge Ben - Mas Que Nada")
+	log.SongSeen("Gal Costa - Baby")
+	log.StationStarted(japan)
+	log.SongSeen("Ryo Fukui - Early Summer")
+	log.Stopped()
+
+	clock = now
+	log.StationStarted(brazil)
+	log.SongSeen("Tim Maia - Azul da Cor do Mar")
+
+	// a torn line at the end shouldn't break replay
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"time":"2024-01-1`)
+	f.Close()
+
+	all, err := log.Listens(Query{})
+	if err != nil {
+		t.Fatalf("Listens failed: %v", err)
+	}
+	if len(all) != 3 || all[0].StationName != "Rádio Samba" || !all[0].End.IsZero() {
+		t.Fatalf("Listens = %+v", all)
+	}
+
+	q, err := ParseQuery([]string{"country=BR", "day=tuesday"}, now)
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	tuesday, err := log.Listens(q)
+	if err != nil || len(tuesday) != 1 {
+		t.Fatalf("Listens(tuesday, BR) = %+v, %v", tuesday, err)
+	}
+	songs := tuesday[0].Songs
+	if len(songs) != 2 || !songs[0].Detected || !songs[0].Added || songs[1].Added {
+		t.Errorf("songs = %+v", songs)
+	}
+	if tuesday[0].End.IsZero() {
+		t.Error("listen should end when the next station starts")
+	}
+
+	q, _ = ParseQuery([]string{"song=azul"}, now)
+	if got, _ := log.Listens(q); len(got) != 1 || len(got[0].Songs) != 1 {
+		t.Errorf("Listens(song=azul) = %+v", got)
+	}
+	if _, err := ParseQuery([]string{"day=someday"}, now); err == nil {
+		t.Error("ParseQuery should reject unknown days")
+	}
+}
+
+func TestLogStationFailed(t *testing.T) {
+	log := NewLog(filepath.Join(t.TempDir(), "history.jsonl"))
+	flaky := &api.Station{UUID: "flaky", Name: "Flaky FM"}
+
+	log.StationStarted(flaky)
+	log.SongSeen("Nina Simone - Sinnerman")
+	log.StationFailed(flaky, errors.New("connection reset"))
+
+	listens, err := log.Listens(Query{})
+	if err != nil {
+		t.Fatalf("Listens failed: %v", err)
+	}
+	if len(listens) != 1 || listens[0].Failed != "connection reset" || listens[0].End.IsZero() || len(listens[0].Songs) != 1 {
+		t.Errorf("Listens = %+v", listens)
+	}
+}
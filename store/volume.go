@@ -0,0 +1,102 @@
+package store
+
+import (
+	"cli-radio/api"
+	"fmt"
+	"sync"
+)
+
+var volumeFile = "store/volume.json"
+
+const (
+	DefaultVolume = 100
+	// a station can be at most this much louder or quieter than the master volume
+	maxOffset = 50
+)
+
+// Volume remembers the master volume and how much louder or quieter each station
+// should be than it, so a quiet station stays turned up next time
+type Volume struct {
+	path string
+	mu   sync.Mutex
+	data volumeData
+}
+
+type volumeData struct {
+	Master  int            `json:"master"`
+	Offsets map[string]int `json:"offsets,omitempty"` // keyed by Station.Key()
+}
+
+// OpenVolume loads store/volume.json
+func OpenVolume() (*Volume, error) {
+	return LoadVolume(volumeFile)
+}
+
+func LoadVolume(path string) (*Volume, error) {
+	v := &Volume{path: path, data: volumeData{Master: DefaultVolume}}
+	if err := readJSON(path, &v.data); err != nil {
+		return nil, fmt.Errorf("failed to load volume settings: %w", err)
+	}
+	if v.data.Offsets == nil {
+		v.data.Offsets = map[string]int{}
+	}
+	v.data.Master = clamp(v.data.Master, 0, 100)
+	return v, nil
+}
+
+func (v *Volume) Master() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.data.Master
+}
+
+// SetMaster changes the volume every station is relative to, from 0 to 100
+func (v *Volume) SetMaster(percent int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.data.Master = clamp(percent, 0, 100)
+	return writeJSON(v.path, v.data)
+}
+
+// Offset is how much louder (or quieter, if negative) a station plays than the master volume
+func (v *Volume) Offset(s *api.Station) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.data.Offsets[s.Key()]
+}
+
+// Adjust nudges a station's offset by delta and returns the new one. The offset stops where
+// the station hits 0 or 100, so there's no hidden excess for later presses to work off.
+func (v *Volume) Adjust(s *api.Station, delta int) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	lo, hi := max(-maxOffset, -v.data.Master), min(maxOffset, 100-v.data.Master)
+	offset := clamp(clamp(v.data.Offsets[s.Key()], lo, hi)+delta, lo, hi)
+	if offset == 0 {
+		delete(v.data.Offsets, s.Key())
+	} else {
+		v.data.Offsets[s.Key()] = offset
+	}
+	return offset, writeJSON(v.path, v.data)
+}
+
+// For is the volume to play a station at: the master volume plus its offset
+func (v *Volume) For(s *api.Station) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	level := v.data.Master
+	if s != nil {
+		level += v.data.Offsets[s.Key()]
+	}
+	return clamp(level, 0, 100)
+}
+
+func clamp(n, lo, hi int) int {
+	if n < lo {
+		return lo
+	}
+	if n > hi {
+		return hi
+	}
+	return n
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"cli-radio/api"
+	"path/filepath"
+	"testing"
+)
+
+func TestVolumePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "volume.json")
+	vol, err := LoadVolume(path)
+	if err != nil {
+		t.Fatalf("LoadVolume failed: %v", err)
+	}
+	quiet := &api.Station{UUID: "quiet", Name: "Quiet FM"}
+	loud := &api.Station{UUID: "loud", Name: "Loud FM"}
+
+	if vol.Master() != DefaultVolume || vol.For(quiet) != DefaultVolume {
+		t.Fatalf("defaults = %d, %d", vol.Master(), vol.For(quiet))
+	}
+	if err := vol.SetMaster(60); err != nil {
+		t.Fatalf("SetMaster failed: %v", err)
+	}
+	vol.Adjust(quiet, 10)
+	vol.Adjust(quiet, 5)
+	vol.Adjust(loud, -20)
+
+	reloaded, err := LoadVolume(path)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if reloaded.Master() != 60 || reloaded.Offset(quiet) != 15 || reloaded.For(quiet) != 75 || reloaded.For(loud) != 40 {
+		t.Errorf("reloaded master %d, quiet %d (%+d), loud %d", reloaded.Master(), reloaded.For(quiet), reloaded.Offset(quiet), reloaded.For(loud))
+	}
+	if got := reloaded.For(&api.Station{UUID: "new"}); got != 60 {
+		t.Errorf("unknown station plays at %d, want the master volume", got)
+	}
+}
+
+func TestVolumeLimits(t *testing.T) {
+	vol, _ := LoadVolume(filepath.Join(t.TempDir(), "volume.json"))
+	s := &api.Station{UUID: "s"}
+
+	vol.SetMaster(150)
+	if vol.Master() != 100 {
+		t.Errorf("master = %d, want it capped at 100", vol.Master())
+	}
+	// already as loud as it goes, so turning up does nothing rather than build up an offset
+	if offset, _ := vol.Adjust(s, 5); offset != 0 {
+		t.Errorf("offset at full volume = %d, want 0", offset)
+	}
+	if offset, _ := vol.Adjust(s, -5); offset != -5 || vol.For(s) != 95 {
+		t.Errorf("turning down after that = %+d, playing at %d, want -5 and 95", offset, vol.For(s))
+	}
+	vol.SetMaster(60)
+	if offset, _ := vol.Adjust(s, 500); offset != 40 || vol.For(s) != 100 {
+		t.Errorf("offset = %d, playing at %d, want 40 and 100", offset, vol.For(s))
+	}
+	vol.SetMaster(20)
+	if offset, _ := vol.Adjust(s, 500); offset != maxOffset {
+		t.Errorf("offset = %d, want %d", offset, maxOffset)
+	}
+	vol.SetMaster(-3)
+	if vol.Master() != 0 {
+		t.Errorf("master = %d, want 0", vol.Master())
+	}
+	// back to zero forgets the station
+	vol.Adjust(s, -maxOffset)
+	if _, ok := vol.data.Offsets[s.Key()]; ok {
+		t.Error("a zero offset should be dropped")
+	}
+}